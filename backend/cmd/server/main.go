@@ -1,13 +1,26 @@
 package main
 
 import (
+	"expvar"
 	"log"
 
 	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/authz"
+	"p2p-chat-app/backend/internal/cluster"
 	"p2p-chat-app/backend/internal/config"
 	"p2p-chat-app/backend/internal/db"
+	"p2p-chat-app/backend/internal/deletion"
 	"p2p-chat-app/backend/internal/handlers"
+	"p2p-chat-app/backend/internal/icepolicy"
+	"p2p-chat-app/backend/internal/lockout"
 	"p2p-chat-app/backend/internal/middleware"
+	"p2p-chat-app/backend/internal/notify"
+	"p2p-chat-app/backend/internal/oidc"
+	"p2p-chat-app/backend/internal/presence"
+	"p2p-chat-app/backend/internal/ratelimit"
+	"p2p-chat-app/backend/internal/session"
+	"p2p-chat-app/backend/internal/tokens"
 	"p2p-chat-app/backend/internal/ws"
 )
 
@@ -18,24 +31,129 @@ func main() {
 		log.Fatalf("db error: %v", err)
 	}
 
+	var bus cluster.Bus = cluster.NewLocalBus()
+	if cfg.ClusterBus == "mysql" {
+		bus, err = cluster.NewDBBus(database, cfg.NodeID, cfg.ClusterPollInterval)
+		if err != nil {
+			log.Fatalf("cluster bus error: %v", err)
+		}
+	}
+	presenceStore := presence.NewStore(database, bus, cfg.NodeID, cfg.PresenceFlushInterval)
+	leases := presence.NewLeases(database, presenceStore, cfg.PresenceLeaseTTL, cfg.PresenceHeartbeat)
+	if err := leases.Start(); err != nil {
+		log.Fatalf("presence lease error: %v", err)
+	}
+
+	kek, err := tokens.LoadKEK(cfg.JWTKeyEncryptionKey, cfg.JWTKEKFile)
+	if err != nil {
+		log.Fatalf("signing key error: %v", err)
+	}
+	tokenManager, err := tokens.NewManager(database, tokens.Config{
+		Alg:         cfg.JWTAlg,
+		Issuer:      cfg.JWTIssuer,
+		Audience:    cfg.JWTAudience,
+		RotateEvery: cfg.JWTRotateEvery,
+		VerifyGrace: cfg.JWTKeyGrace,
+		KEK:         kek,
+	})
+	if err != nil {
+		log.Fatalf("signing key error: %v", err)
+	}
+
 	router := gin.Default()
-	router.Use(middleware.CORS(cfg.AllowedOrigin))
-	router.Use(middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst).Middleware())
+	router.Use(middleware.CORS(cfg.AllowedOrigins))
 
-	authHandler := &handlers.AuthHandler{DB: database, JWTSecret: cfg.JWTSecret}
-	friendsHandler := &handlers.FriendsHandler{DB: database}
-	groupsHandler := &handlers.GroupsHandler{DB: database}
-	presenceHandler := &handlers.PresenceHandler{DB: database}
+	var limiter ratelimit.Limiter = ratelimit.NewMemory()
+	if cfg.RateLimitBackend == "redis" {
+		limiter = ratelimit.NewFallback(ratelimit.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisPoolSize), limiter)
+	}
+	policies, err := ratePolicies(cfg)
+	if err != nil {
+		log.Fatalf("rate limit error: %v", err)
+	}
+	rateLimit := middleware.RateLimit(limiter, policies)
+	ipRateLimit := middleware.IPRateLimit(limiter, policies.IP)
+
+	guard := lockout.NewGuard(database, lockout.Config{
+		BackoffBase:     cfg.LoginBackoffBase,
+		BackoffMax:      cfg.LoginBackoffMax,
+		FailureWindow:   cfg.LoginFailureWindow,
+		UserThreshold:   cfg.LoginLockoutThreshold,
+		IPThreshold:     cfg.LoginIPLockoutLimit,
+		LockoutDuration: cfg.LoginLockoutDuration,
+	})
+	sessions := session.NewRevocations(bus)
+	authHandler := &handlers.AuthHandler{
+		DB:        database,
+		Tokens:    tokenManager,
+		Sessions:  sessions,
+		Guard:     guard,
+		Notifier:  notify.New(cfg.Notifier, cfg.NotifierFile),
+		ResetTTL:  cfg.PasswordResetTTL,
+		MFAIssuer: cfg.MFAIssuer,
+
+		Providers:            oidcProviders(cfg),
+		DisablePasswordLogin: !cfg.PasswordLoginEnabled,
+	}
+	authHandler.TrackLegacyHashes()
+	if err := authHandler.SealLegacyMFASecrets(); err != nil {
+		log.Fatalf("2fa secret migration error: %v", err)
+	}
+	authzCache := authz.NewCache(database, bus, cfg.AuthzCacheTTL)
+	friendsHandler := &handlers.FriendsHandler{DB: database, Authz: authzCache}
+	groupsHandler := &handlers.GroupsHandler{DB: database, Authz: authzCache}
 	usersHandler := &handlers.UsersHandler{DB: database}
 
+	icePolicies := icepolicy.NewStore(database, bus)
+	hub := ws.NewHub()
+	wsHandler := ws.NewHandler(hub, database, presenceStore, icePolicies, authzCache, tokenManager, sessions)
+	wsHandler.IdleAfter = cfg.PresenceIdleAfter
+	wsHandler.AllowedOrigins = cfg.AllowedOrigins
+	wsHandler.WriteTimeout = cfg.WSWriteTimeout
+	wsHandler.StallTimeout = cfg.WSStallTimeout
+	wsHandler.MaxQueue = cfg.WSMaxQueue
+	wsHandler.ReadLimit = int64(cfg.WSReadLimit)
+	wsHandler.MaxSDPSize = cfg.WSMaxSDPSize
+	wsHandler.RateLimit = ws.RateLimit{RPS: cfg.WSRateLimitRPS, Burst: cfg.WSRateLimitBurst}
+	wsHandler.TypeLimits, err = ws.ParseRateLimits(cfg.WSTypeLimits)
+	if err != nil {
+		log.Fatalf("ws rate limit error: %v", err)
+	}
+	wsHandler.ThrottleAfter = cfg.WSThrottleAfter
+	wsHandler.DisconnectAfter = cfg.WSDisconnectAfter
+	wsHandler.ThrottleDelay = cfg.WSThrottleDelay
+	presenceHandler := &handlers.PresenceHandler{DB: database, Store: presenceStore}
+	icePolicyHandler := &handlers.ICEPolicyHandler{Store: icePolicies}
+	jwksHandler := &handlers.JWKSHandler{Tokens: tokenManager}
+	sessionsHandler := &handlers.SessionsHandler{DB: database, Sessions: sessions}
+	serviceAccountsHandler := &handlers.ServiceAccountsHandler{DB: database, Sessions: sessions}
+	accountHandler := &handlers.AccountHandler{DB: database, Auth: authHandler, DeletionGrace: cfg.DeletionGrace}
+	deletion.NewWorker(database, cfg.NodeID, presenceStore, authzCache, sessions, cfg.DeletionInterval).Start()
+
 	api := router.Group("/api/v1")
-	api.POST("/auth/register", authHandler.Register)
-	api.POST("/auth/login", authHandler.Login)
+	api.POST("/auth/register", rateLimit, authHandler.Register)
+	api.POST("/auth/login", rateLimit, authHandler.Login)
+	api.POST("/auth/password/forgot", rateLimit, authHandler.ForgotPassword)
+	api.POST("/auth/password/reset", rateLimit, authHandler.ResetPassword)
+	api.POST("/auth/mfa/verify", rateLimit, authHandler.VerifyMFA)
+	api.GET("/auth/oidc/providers", rateLimit, authHandler.OIDCProviders)
+	api.POST("/auth/oidc/:provider/start", rateLimit, authHandler.StartOIDC)
+	api.POST("/auth/oidc/:provider/callback", rateLimit, authHandler.OIDCCallback)
 
 	authed := api.Group("")
-	authed.Use(middleware.JWTAuth(cfg.JWTSecret))
+	authed.Use(ipRateLimit, middleware.JWTAuth(tokenManager, database), middleware.RequireScope(apiKeyScopes()), rateLimit)
+	authed.POST("/auth/password", authHandler.ChangePassword)
+	authed.GET("/auth/mfa", authHandler.MFAStatus)
+	authed.POST("/auth/mfa/enroll", authHandler.EnrollMFA)
+	authed.POST("/auth/mfa/confirm", authHandler.ConfirmMFA)
+	authed.POST("/auth/mfa/disable", authHandler.DisableMFA)
+	authed.POST("/auth/oidc/:provider/link", authHandler.LinkOIDC)
+	authed.POST("/auth/oidc/:provider/link/callback", authHandler.OIDCLinkCallback)
+	authed.GET("/users/me/identities", authHandler.Identities)
+	authed.DELETE("/users/me/identities/:provider", authHandler.UnlinkIdentity)
 	authed.POST("/friends/request", friendsHandler.Request)
 	authed.POST("/friends/accept", friendsHandler.Accept)
+	authed.POST("/friends/remove", friendsHandler.Remove)
 	authed.GET("/friends/requests", friendsHandler.Requests)
 	authed.GET("/friends/list", friendsHandler.List)
 	authed.POST("/groups", groupsHandler.Create)
@@ -44,15 +162,107 @@ func main() {
 	authed.GET("/groups/:id/members", groupsHandler.Members)
 	authed.GET("/groups/list", groupsHandler.List)
 	authed.GET("/presence", presenceHandler.List)
+	authed.PUT("/presence", presenceHandler.Update)
+	authed.GET("/presence/privacy", presenceHandler.Privacy)
+	authed.PUT("/presence/privacy", presenceHandler.UpdatePrivacy)
 	authed.GET("/users/me", usersHandler.Me)
 	authed.GET("/users/search", usersHandler.Search)
+	authed.POST("/ws/ticket", wsHandler.IssueTicket)
+	authed.GET("/users/me/export", accountHandler.Export)
+	authed.DELETE("/users/me", accountHandler.Delete)
+	authed.GET("/users/me/deletion", accountHandler.DeletionStatus)
+	authed.DELETE("/users/me/deletion", accountHandler.CancelDeletion)
+	authed.GET("/users/me/sessions", sessionsHandler.List)
+	authed.DELETE("/users/me/sessions/:id", sessionsHandler.Revoke)
+	authed.GET("/users/me/ice-policy", icePolicyHandler.Get)
+	authed.PUT("/users/me/ice-policy", icePolicyHandler.Update)
+	authed.POST("/service-accounts", serviceAccountsHandler.Create)
+	authed.GET("/service-accounts", serviceAccountsHandler.List)
+	authed.DELETE("/service-accounts/:id", serviceAccountsHandler.Delete)
+	authed.POST("/service-accounts/:id/keys", serviceAccountsHandler.CreateKey)
+	authed.GET("/service-accounts/:id/keys", serviceAccountsHandler.ListKeys)
+	authed.DELETE("/service-accounts/:id/keys/:keyId", serviceAccountsHandler.RevokeKey)
 
-	hub := ws.NewHub()
-	wsHandler := &ws.Handler{Hub: hub, DB: database, JWTSecret: cfg.JWTSecret}
-	router.GET("/ws", wsHandler.ServeWS)
+	router.GET("/ws", rateLimit, wsHandler.ServeWS)
+	router.GET("/.well-known/jwks.json", jwksHandler.Get)
+	if cfg.MetricsEnabled {
+		router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	}
 
 	log.Printf("server listening on :%s", cfg.Port)
 	if err := router.Run(":" + cfg.Port); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+func oidcProviders(cfg config.Config) map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil)
+	}
+	return providers
+}
+
+func apiKeyScopes() map[string]string {
+	return map[string]string{
+		"GET /api/v1/friends/requests":   apikey.ScopeFriendsRead,
+		"GET /api/v1/friends/list":       apikey.ScopeFriendsRead,
+		"POST /api/v1/friends/request":   apikey.ScopeFriendsWrite,
+		"POST /api/v1/friends/accept":    apikey.ScopeFriendsWrite,
+		"POST /api/v1/friends/remove":    apikey.ScopeFriendsWrite,
+		"GET /api/v1/groups/:id/members": apikey.ScopeGroupsRead,
+		"GET /api/v1/groups/list":        apikey.ScopeGroupsRead,
+		"POST /api/v1/groups":            apikey.ScopeGroupsWrite,
+		"POST /api/v1/groups/invite":     apikey.ScopeGroupsWrite,
+		"POST /api/v1/groups/leave":      apikey.ScopeGroupsWrite,
+		"GET /api/v1/presence":           apikey.ScopePresenceRead,
+		"PUT /api/v1/presence":           apikey.ScopePresenceWrite,
+		"GET /api/v1/users/me":           apikey.ScopeUsersRead,
+		"GET /api/v1/users/search":       apikey.ScopeUsersRead,
+	}
+}
+
+func ratePolicies(cfg config.Config) (middleware.RatePolicies, error) {
+	read, err := ratelimit.ParsePolicy("read", cfg.RateLimitRead)
+	if err != nil {
+		return middleware.RatePolicies{}, err
+	}
+	auth, err := ratelimit.ParsePolicy("auth", cfg.RateLimitAuth)
+	if err != nil {
+		return middleware.RatePolicies{}, err
+	}
+	wsConnect, err := ratelimit.ParsePolicy("ws", cfg.RateLimitWS)
+	if err != nil {
+		return middleware.RatePolicies{}, err
+	}
+	ip, err := ratelimit.ParsePolicy("ip", cfg.RateLimitIP)
+	if err != nil {
+		return middleware.RatePolicies{}, err
+	}
+	write := ratelimit.Policy{Name: "write", Rate: cfg.RateLimitRPS, Burst: cfg.RateLimitBurst}
+	if err := write.Validate(); err != nil {
+		return middleware.RatePolicies{}, err
+	}
+	return middleware.RatePolicies{
+		Routes: map[string]ratelimit.Policy{
+			"POST /api/v1/auth/login":                   auth,
+			"POST /api/v1/auth/register":                auth,
+			"POST /api/v1/auth/password/forgot":         auth,
+			"POST /api/v1/auth/password/reset":          auth,
+			"POST /api/v1/auth/mfa/verify":              auth,
+			"POST /api/v1/auth/oidc/:provider/start":    auth,
+			"POST /api/v1/auth/oidc/:provider/callback": auth,
+			"GET /ws": wsConnect,
+		},
+		Read:  read,
+		Write: write,
+		IP:    ip,
+	}, nil
+}
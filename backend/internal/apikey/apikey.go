@@ -0,0 +1,244 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"p2p-chat-app/backend/internal/ratelimit"
+)
+
+const (
+	Prefix = "p2p."
+
+	ScopeFriendsRead   = "friends:read"
+	ScopeFriendsWrite  = "friends:write"
+	ScopeGroupsRead    = "groups:read"
+	ScopeGroupsWrite   = "groups:write"
+	ScopePresenceRead  = "presence:read"
+	ScopePresenceWrite = "presence:write"
+	ScopeUsersRead     = "users:read"
+	ScopeSignalSend    = "signal:send"
+
+	touchInterval = time.Minute
+)
+
+var Scopes = []string{
+	ScopeFriendsRead,
+	ScopeFriendsWrite,
+	ScopeGroupsRead,
+	ScopeGroupsWrite,
+	ScopePresenceRead,
+	ScopePresenceWrite,
+	ScopeUsersRead,
+	ScopeSignalSend,
+}
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+type Key struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"serviceAccountId"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  string     `json:"rateLimit,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+}
+
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Key) Policy() (ratelimit.Policy, bool) {
+	if k.RateLimit == "" {
+		return ratelimit.Policy{}, false
+	}
+	p, err := ratelimit.ParsePolicy("apikey", k.RateLimit)
+	return p, err == nil
+}
+
+func SessionID(keyID string) string {
+	return "apikey:" + keyID
+}
+
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !validScope(s) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidScope
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func Create(db *sql.DB, userID, name string, scopes []string, rateLimit string, expiresAt *time.Time) (string, *Key, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	k := &Key{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	raw := Prefix + k.ID + "." + base64.RawURLEncoding.EncodeToString(secret)
+	_, err := db.Exec(`
+		INSERT INTO api_keys (key_id, user_id, name, key_hash, scopes, rate_limit, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, k.ID, userID, name, hashKey(raw), strings.Join(scopes, " "), rateLimit, k.CreatedAt, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, k, nil
+}
+
+func Authenticate(db *sql.DB, raw, ip string) (*Key, error) {
+	id, ok := parse(raw)
+	if !ok {
+		return nil, nil
+	}
+	var k Key
+	var keyHash, scopes string
+	var expiresAt, lastUsed sql.NullTime
+	err := db.QueryRow(`
+		SELECT k.key_id, k.user_id, k.name, k.key_hash, k.scopes, k.rate_limit, k.created_at, k.expires_at, k.last_used_at
+		FROM api_keys k
+		JOIN service_accounts s ON s.user_id = k.user_id
+		WHERE k.key_id = ? AND k.revoked_at IS NULL AND s.disabled_at IS NULL
+	`, id).Scan(&k.ID, &k.UserID, &k.Name, &keyHash, &scopes, &k.RateLimit, &k.CreatedAt, &expiresAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashKey(raw))) != 1 {
+		return nil, nil
+	}
+	now := time.Now()
+	if expiresAt.Valid && now.After(expiresAt.Time) {
+		return nil, nil
+	}
+	k.Scopes = strings.Fields(scopes)
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) >= touchInterval {
+		if _, err := db.Exec(`
+			UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE key_id = ?
+		`, now, ip, k.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &k, nil
+}
+
+func List(db *sql.DB, userID string) ([]Key, error) {
+	rows, err := db.Query(`
+		SELECT key_id, user_id, name, scopes, rate_limit, created_at, expires_at, last_used_at, last_used_ip
+		FROM api_keys
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		var k Key
+		var scopes string
+		var expiresAt, lastUsed sql.NullTime
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &scopes, &k.RateLimit, &k.CreatedAt, &expiresAt, &lastUsed, &k.LastUsedIP); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Fields(scopes)
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func Revoke(db *sql.DB, userID, keyID string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE api_keys SET revoked_at = ?
+		WHERE user_id = ? AND key_id = ? AND revoked_at IS NULL
+	`, time.Now(), userID, keyID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func parse(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, Prefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok || len(id) != 16 || secret == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,258 @@
+package authz
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+const topicInvalidate = "authz.invalidate"
+
+const (
+	kindFriendship = "friendship"
+	kindMembership = "membership"
+)
+
+type invalidation struct {
+	Kind string `json:"kind"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+type entry struct {
+	allowed bool
+	expires time.Time
+}
+
+type listEntry struct {
+	ids     []string
+	expires time.Time
+}
+
+type Cache struct {
+	db  *sql.DB
+	bus cluster.Bus
+	ttl time.Duration
+
+	mu         sync.Mutex
+	friends    map[[2]string]entry
+	members    map[[2]string]entry
+	groups     map[string]listEntry
+	friendList map[string]listEntry
+	generation uint64
+}
+
+func NewCache(db *sql.DB, bus cluster.Bus, ttl time.Duration) *Cache {
+	c := &Cache{
+		db:         db,
+		bus:        bus,
+		ttl:        ttl,
+		friends:    make(map[[2]string]entry),
+		members:    make(map[[2]string]entry),
+		groups:     make(map[string]listEntry),
+		friendList: make(map[string]listEntry),
+	}
+	bus.Subscribe(topicInvalidate, c.applyRemote)
+	go c.pruneLoop()
+	return c
+}
+
+func (c *Cache) AreFriends(userA, userB string) (bool, error) {
+	key := friendKey(userA, userB)
+	return c.lookup(c.friends, key, func() (bool, error) {
+		var exists int
+		err := c.db.QueryRow(`
+			SELECT 1 FROM friends
+			WHERE (user_id = ? AND friend_user_id = ?) OR (user_id = ? AND friend_user_id = ?)
+			LIMIT 1
+		`, key[0], key[1], key[1], key[0]).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func (c *Cache) IsMember(groupID, userID string) (bool, error) {
+	key := [2]string{groupID, userID}
+	return c.lookup(c.members, key, func() (bool, error) {
+		var exists int
+		err := c.db.QueryRow(`
+			SELECT 1 FROM group_members
+			WHERE group_id = ? AND user_id = ?
+			LIMIT 1
+		`, groupID, userID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func (c *Cache) BothInGroup(userA, userB, groupID string) (bool, error) {
+	for _, id := range []string{userA, userB} {
+		ok, err := c.IsMember(groupID, id)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c *Cache) GroupsOf(userID string) ([]string, error) {
+	return c.list(c.groups, userID, `SELECT group_id FROM group_members WHERE user_id = ?`)
+}
+
+func (c *Cache) FriendsOf(userID string) ([]string, error) {
+	return c.list(c.friendList, userID, `SELECT friend_user_id FROM friends WHERE user_id = ?`)
+}
+
+func (c *Cache) SharesGroup(userA, userB string) (bool, error) {
+	groupsA, err := c.GroupsOf(userA)
+	if err != nil {
+		return false, err
+	}
+	groupsB, err := c.GroupsOf(userB)
+	if err != nil {
+		return false, err
+	}
+	shared := make(map[string]struct{}, len(groupsA))
+	for _, id := range groupsA {
+		shared[id] = struct{}{}
+	}
+	for _, id := range groupsB {
+		if _, ok := shared[id]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Cache) InvalidateFriendship(userA, userB string) {
+	c.invalidate(invalidation{Kind: kindFriendship, A: userA, B: userB}, true)
+}
+
+func (c *Cache) InvalidateMembership(groupID, userID string) {
+	c.invalidate(invalidation{Kind: kindMembership, A: groupID, B: userID}, true)
+}
+
+func (c *Cache) lookup(table map[[2]string]entry, key [2]string, load func() (bool, error)) (bool, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := table[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.allowed, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	allowed, err := load()
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	if c.generation == generation {
+		table[key] = entry{allowed: allowed, expires: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return allowed, nil
+}
+
+func (c *Cache) list(table map[string]listEntry, userID, query string) ([]string, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := table[userID]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.ids, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.generation == generation {
+		table[userID] = listEntry{ids: ids, expires: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return ids, nil
+}
+
+func (c *Cache) invalidate(inv invalidation, broadcast bool) {
+	c.mu.Lock()
+	c.generation++
+	switch inv.Kind {
+	case kindFriendship:
+		delete(c.friends, friendKey(inv.A, inv.B))
+		delete(c.friendList, inv.A)
+		delete(c.friendList, inv.B)
+	case kindMembership:
+		delete(c.members, [2]string{inv.A, inv.B})
+		delete(c.groups, inv.B)
+	}
+	c.mu.Unlock()
+	if !broadcast {
+		return
+	}
+	if err := c.bus.Publish(topicInvalidate, inv); err != nil {
+		log.Printf("authz invalidate publish error: %v", err)
+	}
+}
+
+func (c *Cache) applyRemote(ev cluster.Event) {
+	var inv invalidation
+	if err := json.Unmarshal(ev.Data, &inv); err != nil {
+		log.Printf("authz event decode error: %v", err)
+		return
+	}
+	c.invalidate(inv, false)
+}
+
+func (c *Cache) pruneLoop() {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		c.mu.Lock()
+		for _, table := range []map[[2]string]entry{c.friends, c.members} {
+			for key, e := range table {
+				if now.After(e.expires) {
+					delete(table, key)
+				}
+			}
+		}
+		for _, table := range []map[string]listEntry{c.groups, c.friendList} {
+			for key, e := range table {
+				if now.After(e.expires) {
+					delete(table, key)
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func friendKey(userA, userB string) [2]string {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+	return [2]string{userA, userB}
+}
@@ -0,0 +1,40 @@
+package cluster
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+type Event struct {
+	Topic string          `json:"topic"`
+	Node  string          `json:"node"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type Bus interface {
+	Publish(topic string, data interface{}) error
+	PublishMany(topic string, data []interface{}) error
+	Subscribe(topic string, fn func(Event))
+}
+
+type localBus struct{}
+
+func NewLocalBus() Bus {
+	return localBus{}
+}
+
+func (localBus) Publish(string, interface{}) error { return nil }
+
+func (localBus) PublishMany(string, []interface{}) error { return nil }
+
+func (localBus) Subscribe(string, func(Event)) {}
+
+func DefaultNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return uuid.NewString()
+	}
+	return host
+}
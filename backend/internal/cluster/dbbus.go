@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DBBus struct {
+	db       *sql.DB
+	node     string
+	interval time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string][]func(Event)
+	lastID   int64
+}
+
+func NewDBBus(db *sql.DB, node string, interval time.Duration) (*DBBus, error) {
+	b := &DBBus{
+		db:       db,
+		node:     node,
+		interval: interval,
+		handlers: make(map[string][]func(Event)),
+	}
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM cluster_events`).Scan(&b.lastID); err != nil {
+		return nil, err
+	}
+	go b.pollLoop()
+	return b, nil
+}
+
+func (b *DBBus) Publish(topic string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(`INSERT INTO cluster_events (node_id, topic, data) VALUES (?, ?, ?)`, b.node, topic, payload)
+	return err
+}
+
+func (b *DBBus) PublishMany(topic string, data []interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	query := `INSERT INTO cluster_events (node_id, topic, data) VALUES ` + strings.Repeat("(?, ?, ?), ", len(data)-1) + "(?, ?, ?)"
+	args := make([]interface{}, 0, 3*len(data))
+	for _, d := range data {
+		payload, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		args = append(args, b.node, topic, payload)
+	}
+	_, err := b.db.Exec(query, args...)
+	return err
+}
+
+func (b *DBBus) Subscribe(topic string, fn func(Event)) {
+	b.mu.Lock()
+	b.handlers[topic] = append(b.handlers[topic], fn)
+	b.mu.Unlock()
+}
+
+func (b *DBBus) pollLoop() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(time.Minute)
+	defer pruneTicker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.poll(); err != nil {
+				log.Printf("cluster poll error: %v", err)
+			}
+		case <-pruneTicker.C:
+			if _, err := b.db.Exec(`DELETE FROM cluster_events WHERE created_at < NOW() - INTERVAL 5 MINUTE`); err != nil {
+				log.Printf("cluster prune error: %v", err)
+			}
+		}
+	}
+}
+
+func (b *DBBus) poll() error {
+	rows, err := b.db.Query(`
+		SELECT id, node_id, topic, data
+		FROM cluster_events
+		WHERE id > ?
+		ORDER BY id ASC
+		LIMIT 500
+	`, b.lastID)
+	if err != nil {
+		return err
+	}
+	events := make([]Event, 0)
+	for rows.Next() {
+		var id int64
+		var ev Event
+		var data []byte
+		if err := rows.Scan(&id, &ev.Node, &ev.Topic, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		b.lastID = id
+		if ev.Node == b.node {
+			continue
+		}
+		ev.Data = data
+		events = append(events, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ev := range events {
+		b.mu.RLock()
+		handlers := b.handlers[ev.Topic]
+		b.mu.RUnlock()
+		for _, fn := range handlers {
+			fn(ev)
+		}
+	}
+	return nil
+}
@@ -1,35 +1,192 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"p2p-chat-app/backend/internal/cluster"
+	"p2p-chat-app/backend/internal/ws"
 )
 
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
 type Config struct {
-	Port          string
-	DBDSN         string
-	JWTSecret     string
-	AllowedOrigin string
-	RateLimitRPS  float64
-	RateLimitBurst int
+	Port                  string
+	DBDSN                 string
+	JWTAlg                string
+	JWTIssuer             string
+	JWTAudience           string
+	JWTRotateEvery        time.Duration
+	JWTKeyGrace           time.Duration
+	JWTKeyEncryptionKey   string
+	JWTKEKFile            string
+	AllowedOrigins        []string
+	RateLimitRPS          float64
+	RateLimitBurst        int
+	RateLimitRead         string
+	RateLimitAuth         string
+	RateLimitWS           string
+	RateLimitIP           string
+	RateLimitBackend      string
+	RedisAddr             string
+	RedisPassword         string
+	RedisPoolSize         int
+	PresenceIdleAfter     time.Duration
+	PresenceFlushInterval time.Duration
+	PresenceLeaseTTL      time.Duration
+	PresenceHeartbeat     time.Duration
+	NodeID                string
+	ClusterBus            string
+	ClusterPollInterval   time.Duration
+	WSWriteTimeout        time.Duration
+	WSStallTimeout        time.Duration
+	WSMaxQueue            int
+	WSReadLimit           int
+	WSMaxSDPSize          int
+	WSRateLimitRPS        float64
+	WSRateLimitBurst      int
+	WSTypeLimits          string
+	WSThrottleAfter       int
+	WSDisconnectAfter     int
+	WSThrottleDelay       time.Duration
+	AuthzCacheTTL         time.Duration
+	LoginBackoffBase      time.Duration
+	LoginBackoffMax       time.Duration
+	LoginFailureWindow    time.Duration
+	LoginLockoutThreshold int
+	LoginIPLockoutLimit   int
+	LoginLockoutDuration  time.Duration
+	PasswordResetTTL      time.Duration
+	Notifier              string
+	NotifierFile          string
+	MFAIssuer             string
+	PasswordLoginEnabled  bool
+	OIDCProviders         []OIDCProvider
+	DeletionGrace         time.Duration
+	DeletionInterval      time.Duration
+	MetricsEnabled        bool
 }
 
 func Load() Config {
 	cfg := Config{
-		Port:          getEnv("PORT", "8080"),
-		DBDSN:         getEnv("DB_DSN", "root:Jim2002@tcp(127.0.0.1:3306)/P2P_Chat?parseTime=true"),
-		JWTSecret:     getEnv("JWT_SECRET", "CacHeThongPhanTanMaster2025"),
-		AllowedOrigin: getEnv("ALLOWED_ORIGIN", "http://localhost:5173"),
-		RateLimitRPS:  getEnvFloat("RATE_LIMIT_RPS", 5),
-		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", 10),
+		Port:                  getEnv("PORT", "8080"),
+		DBDSN:                 getEnv("DB_DSN", "root:Jim2002@tcp(127.0.0.1:3306)/P2P_Chat?parseTime=true"),
+		JWTAlg:                getEnv("JWT_ALG", "EdDSA"),
+		JWTIssuer:             getEnv("JWT_ISSUER", "p2p-chat-app"),
+		JWTAudience:           getEnv("JWT_AUDIENCE", "p2p-chat-app"),
+		JWTRotateEvery:        getEnvDuration("JWT_ROTATE_EVERY", 7*24*time.Hour),
+		JWTKeyGrace:           getEnvDuration("JWT_KEY_GRACE", 48*time.Hour),
+		JWTKeyEncryptionKey:   getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
+		JWTKEKFile:            getEnv("JWT_KEK_FILE", ""),
+		AllowedOrigins:        getEnvList("ALLOWED_ORIGIN", "http://localhost:5173"),
+		RateLimitRPS:          getEnvFloat("RATE_LIMIT_RPS", 5),
+		RateLimitBurst:        getEnvInt("RATE_LIMIT_BURST", 10),
+		RateLimitRead:         getEnv("RATE_LIMIT_READ", "10:30"),
+		RateLimitAuth:         getEnv("RATE_LIMIT_AUTH", "0.1:5"),
+		RateLimitWS:           getEnv("RATE_LIMIT_WS", "0.5:5"),
+		RateLimitIP:           getEnv("RATE_LIMIT_IP", "20:60"),
+		RateLimitBackend:      getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RedisAddr:             getEnv("REDIS_ADDR", "127.0.0.1:6379"),
+		RedisPassword:         getEnv("REDIS_PASSWORD", ""),
+		RedisPoolSize:         getEnvInt("REDIS_POOL_SIZE", 8),
+		PresenceIdleAfter:     getEnvDuration("PRESENCE_IDLE_AFTER", 5*time.Minute),
+		PresenceFlushInterval: getEnvDuration("PRESENCE_FLUSH_INTERVAL", 2*time.Second),
+		PresenceLeaseTTL:      getEnvDuration("PRESENCE_LEASE_TTL", 30*time.Second),
+		PresenceHeartbeat:     getEnvDuration("PRESENCE_HEARTBEAT_INTERVAL", 10*time.Second),
+		NodeID:                getEnv("NODE_ID", cluster.DefaultNodeID()),
+		ClusterBus:            getEnv("CLUSTER_BUS", "local"),
+		ClusterPollInterval:   getEnvDuration("CLUSTER_POLL_INTERVAL", 500*time.Millisecond),
+		WSWriteTimeout:        getEnvDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		WSStallTimeout:        getEnvDuration("WS_STALL_TIMEOUT", 30*time.Second),
+		WSMaxQueue:            getEnvInt("WS_MAX_QUEUE", 256),
+		WSReadLimit:           getEnvInt("WS_READ_LIMIT", 64*1024),
+		WSMaxSDPSize:          getEnvInt("WS_MAX_SDP_SIZE", 32*1024),
+		WSRateLimitRPS:        getEnvFloat("WS_RATE_LIMIT_RPS", 20),
+		WSRateLimitBurst:      getEnvInt("WS_RATE_LIMIT_BURST", 40),
+		WSTypeLimits:          getEnv("WS_TYPE_LIMITS", ws.DefaultTypeLimits),
+		WSThrottleAfter:       getEnvInt("WS_THROTTLE_AFTER", 5),
+		WSDisconnectAfter:     getEnvInt("WS_DISCONNECT_AFTER", 20),
+		WSThrottleDelay:       getEnvDuration("WS_THROTTLE_DELAY", time.Second),
+		AuthzCacheTTL:         getEnvDuration("AUTHZ_CACHE_TTL", 30*time.Second),
+		LoginBackoffBase:      getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:       getEnvDuration("LOGIN_BACKOFF_MAX", time.Minute),
+		LoginFailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginIPLockoutLimit:   getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100),
+		LoginLockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		PasswordResetTTL:      getEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+		Notifier:              getEnv("NOTIFIER", "log"),
+		NotifierFile:          getEnv("NOTIFIER_FILE", "notifications.log"),
+		MFAIssuer:             getEnv("MFA_ISSUER", "P2P Chat"),
+		PasswordLoginEnabled:  getEnvBool("PASSWORD_LOGIN_ENABLED", true),
+		OIDCProviders:         loadOIDCProviders(),
+		DeletionGrace:         getEnvDuration("ACCOUNT_DELETION_GRACE", 7*24*time.Hour),
+		DeletionInterval:      getEnvDuration("ACCOUNT_DELETION_INTERVAL", time.Minute),
+		MetricsEnabled:        getEnvBool("METRICS_ENABLED", false),
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("config error: %v", err)
 	}
-	if cfg.JWTSecret == "dev_secret_change_me" {
-		log.Println("warning: using default JWT secret, change in production")
+	if cfg.JWTKeyGrace < 24*time.Hour {
+		log.Println("warning: JWT_KEY_GRACE is shorter than the token lifetime, rotated tokens will fail early")
 	}
 	return cfg
 }
 
+func (c Config) validate() error {
+	positive := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"AUTHZ_CACHE_TTL", c.AuthzCacheTTL},
+		{"PRESENCE_FLUSH_INTERVAL", c.PresenceFlushInterval},
+		{"PRESENCE_LEASE_TTL", c.PresenceLeaseTTL},
+		{"PRESENCE_HEARTBEAT_INTERVAL", c.PresenceHeartbeat},
+		{"CLUSTER_POLL_INTERVAL", c.ClusterPollInterval},
+		{"ACCOUNT_DELETION_INTERVAL", c.DeletionInterval},
+		{"WS_WRITE_TIMEOUT", c.WSWriteTimeout},
+		{"WS_STALL_TIMEOUT", c.WSStallTimeout},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %s", p.key, p.value)
+		}
+	}
+	return nil
+}
+
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range getEnvList("OIDC_PROVIDERS", "") {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := OIDCProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", "http://localhost:5173/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid profile email")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("warning: oidc provider %s is missing %sISSUER or %sCLIENT_ID, skipping", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 func getEnv(key, def string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -38,6 +195,17 @@ func getEnv(key, def string) string {
 	return val
 }
 
+func getEnvList(key, def string) []string {
+	parts := strings.Split(getEnv(key, def), ",")
+	list := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
 func getEnvInt(key string, def int) int {
 	val := os.Getenv(key)
 	if val == "" {
@@ -61,3 +229,27 @@ func getEnvFloat(key string, def float64) float64 {
 	}
 	return f
 }
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+func getEnvBool(key string, def bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def
+	}
+	return b
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		AuthzCacheTTL:         30 * time.Second,
+		PresenceFlushInterval: 2 * time.Second,
+		PresenceLeaseTTL:      30 * time.Second,
+		PresenceHeartbeat:     10 * time.Second,
+		ClusterPollInterval:   500 * time.Millisecond,
+		DeletionInterval:      time.Minute,
+		WSWriteTimeout:        10 * time.Second,
+		WSStallTimeout:        30 * time.Second,
+	}
+}
+
+func TestValidateRejectsNonPositiveIntervals(t *testing.T) {
+	if err := validConfig().validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	cases := map[string]func(*Config){
+		"AUTHZ_CACHE_TTL":             func(c *Config) { c.AuthzCacheTTL = 0 },
+		"PRESENCE_FLUSH_INTERVAL":     func(c *Config) { c.PresenceFlushInterval = -time.Second },
+		"PRESENCE_HEARTBEAT_INTERVAL": func(c *Config) { c.PresenceHeartbeat = 0 },
+		"CLUSTER_POLL_INTERVAL":       func(c *Config) { c.ClusterPollInterval = 0 },
+		"ACCOUNT_DELETION_INTERVAL":   func(c *Config) { c.DeletionInterval = 0 },
+	}
+	for key, mutate := range cases {
+		cfg := validConfig()
+		mutate(&cfg)
+		err := cfg.validate()
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s: err = %v, want an error naming it", key, err)
+		}
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	t.Setenv("TEST_DURATION", "0s")
+	if d := getEnvDuration("TEST_DURATION", time.Minute); d != 0 {
+		t.Errorf("getEnvDuration = %s, want 0s", d)
+	}
+	t.Setenv("TEST_DURATION", "soon")
+	if d := getEnvDuration("TEST_DURATION", time.Minute); d != time.Minute {
+		t.Errorf("getEnvDuration = %s, want the default", d)
+	}
+}
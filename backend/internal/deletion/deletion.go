@@ -0,0 +1,269 @@
+package deletion
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"p2p-chat-app/backend/internal/authz"
+	"p2p-chat-app/backend/internal/presence"
+	"p2p-chat-app/backend/internal/session"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+
+	lease        = 5 * time.Minute
+	maxErrorSize = 512
+	maxAttempts  = 5
+	batchSize    = 10
+)
+
+var ErrNotCancellable = errors.New("deletion is already running")
+
+type Job struct {
+	UserID       string     `json:"-"`
+	Status       string     `json:"status"`
+	Step         string     `json:"step,omitempty"`
+	RequestedAt  time.Time  `json:"requestedAt"`
+	ScheduledFor time.Time  `json:"scheduledFor"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+type step struct {
+	name string
+	run  func(w *Worker, userID string) error
+}
+
+var steps = []step{
+	{"sessions", (*Worker).revokeAccess},
+	{"groups", (*Worker).leaveGroups},
+	{"friends", (*Worker).removeFriends},
+	{"presence", (*Worker).clearPresence},
+	{"credentials", (*Worker).deleteCredentials},
+	{"profile", (*Worker).deleteProfile},
+}
+
+type Worker struct {
+	db       *sql.DB
+	node     string
+	presence *presence.Store
+	authz    *authz.Cache
+	sessions *session.Revocations
+	interval time.Duration
+	steps    []step
+}
+
+func NewWorker(db *sql.DB, node string, store *presence.Store, cache *authz.Cache, sessions *session.Revocations, interval time.Duration) *Worker {
+	return &Worker{
+		db:       db,
+		node:     node,
+		presence: store,
+		authz:    cache,
+		sessions: sessions,
+		interval: interval,
+		steps:    steps,
+	}
+}
+
+func Schedule(db *sql.DB, userID string, grace time.Duration) (Job, error) {
+	now := time.Now()
+	job := Job{UserID: userID, Status: StatusPending, RequestedAt: now, ScheduledFor: now.Add(grace)}
+	_, err := db.Exec(`
+		INSERT INTO account_deletions (user_id, status, step, requested_at, scheduled_for)
+		VALUES (?, ?, '', ?, ?)
+		ON DUPLICATE KEY UPDATE
+			requested_at = IF(status IN ('cancelled', 'failed'), VALUES(requested_at), requested_at),
+			scheduled_for = IF(status IN ('cancelled', 'failed'), VALUES(scheduled_for), scheduled_for),
+			attempts = IF(status IN ('cancelled', 'failed'), 0, attempts),
+			last_error = IF(status IN ('cancelled', 'failed'), '', last_error),
+			status = IF(status IN ('cancelled', 'failed'), VALUES(status), status)
+	`, userID, StatusPending, now, job.ScheduledFor)
+	if err != nil {
+		return Job{}, err
+	}
+	current, err := Get(db, userID)
+	if err != nil || current == nil {
+		return job, err
+	}
+	return *current, nil
+}
+
+func Get(db *sql.DB, userID string) (*Job, error) {
+	var job Job
+	var completedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT user_id, status, step, requested_at, scheduled_for, completed_at, attempts, last_error
+		FROM account_deletions WHERE user_id = ?
+	`, userID).Scan(&job.UserID, &job.Status, &job.Step, &job.RequestedAt, &job.ScheduledFor, &completedAt, &job.Attempts, &job.LastError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
+
+func Cancel(db *sql.DB, userID string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE account_deletions SET status = ?
+		WHERE user_id = ? AND status IN ('pending', 'failed') AND step = ''
+	`, StatusCancelled, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		job, err := Get(db, userID)
+		if err != nil {
+			return false, err
+		}
+		if job != nil && (job.Status == StatusRunning || job.Step != "") {
+			return false, ErrNotCancellable
+		}
+	}
+	return n > 0, nil
+}
+
+func (w *Worker) Start() {
+	go w.loop()
+}
+
+func (w *Worker) loop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := w.RunDue(); err != nil {
+			log.Printf("account deletion error: %v", err)
+		}
+	}
+}
+
+func (w *Worker) RunDue() error {
+	rows, err := w.db.Query(`
+		SELECT user_id FROM account_deletions
+		WHERE status IN ('pending', 'running') AND scheduled_for <= ?
+			AND (lease_until IS NULL OR lease_until < ?)
+		ORDER BY scheduled_for
+		LIMIT ?
+	`, time.Now(), time.Now(), batchSize)
+	if err != nil {
+		return err
+	}
+	var due []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range due {
+		claimed, err := w.claim(userID)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			w.run(userID)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) claim(userID string) (bool, error) {
+	now := time.Now()
+	res, err := w.db.Exec(`
+		UPDATE account_deletions
+		SET status = ?, claimed_by = ?, lease_until = ?, attempts = attempts + 1
+		WHERE user_id = ? AND status IN ('pending', 'running') AND scheduled_for <= ?
+			AND (lease_until IS NULL OR lease_until < ?)
+	`, StatusRunning, w.node, now.Add(lease), userID, now, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (w *Worker) run(userID string) {
+	job, err := Get(w.db, userID)
+	if err != nil || job == nil {
+		return
+	}
+	start := 0
+	for i, s := range w.steps {
+		if s.name == job.Step {
+			start = i + 1
+		}
+	}
+	for _, s := range w.steps[start:] {
+		if err := s.run(w, userID); err != nil {
+			log.Printf("account deletion %s step %s failed: %v", userID, s.name, err)
+			w.release(job, s.name, err)
+			return
+		}
+		owned, err := w.owned(`
+			UPDATE account_deletions SET step = ?, lease_until = ? WHERE user_id = ? AND claimed_by = ?
+		`, s.name, time.Now().Add(lease), userID, w.node)
+		if err != nil || !owned {
+			log.Printf("account deletion %s lost its lease after step %s: %v", userID, s.name, err)
+			return
+		}
+	}
+	owned, err := w.owned(`
+		UPDATE account_deletions
+		SET status = ?, completed_at = ?, lease_until = NULL, last_error = ''
+		WHERE user_id = ? AND claimed_by = ?
+	`, StatusDone, time.Now(), userID, w.node)
+	if err != nil || !owned {
+		log.Printf("account deletion %s completion error: %v", userID, err)
+		return
+	}
+	log.Printf("account deleted: %s", userID)
+}
+
+func (w *Worker) release(job *Job, stepName string, cause error) {
+	msg := stepName + ": " + cause.Error()
+	if len(msg) > maxErrorSize {
+		msg = msg[:maxErrorSize]
+	}
+	status, retryAt := StatusRunning, sql.NullTime{Time: time.Now().Add(w.interval), Valid: true}
+	if job.Attempts >= maxAttempts {
+		status, retryAt = StatusFailed, sql.NullTime{}
+		log.Printf("account deletion %s failed after %d attempts", job.UserID, job.Attempts)
+	}
+	if _, err := w.owned(`
+		UPDATE account_deletions SET status = ?, lease_until = ?, last_error = ? WHERE user_id = ? AND claimed_by = ?
+	`, status, retryAt, msg, job.UserID, w.node); err != nil {
+		log.Printf("account deletion %s release error: %v", job.UserID, err)
+	}
+}
+
+func (w *Worker) owned(query string, args ...interface{}) (bool, error) {
+	res, err := w.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
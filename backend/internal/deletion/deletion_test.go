@@ -0,0 +1,258 @@
+package deletion
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"p2p-chat-app/backend/internal/authz"
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+type stepLog struct {
+	mu   sync.Mutex
+	runs []string
+	fail map[string]int
+}
+
+func (l *stepLog) steps(names ...string) []step {
+	var out []step
+	for _, name := range names {
+		name := name
+		out = append(out, step{name, func(w *Worker, userID string) error {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.runs = append(l.runs, w.node+":"+name)
+			if l.fail[name] != 0 {
+				l.fail[name]--
+				return errors.New("boom")
+			}
+			return nil
+		}})
+	}
+	return out
+}
+
+func (l *stepLog) take() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	runs := strings.Join(l.runs, ",")
+	l.runs = nil
+	return runs
+}
+
+func testWorker(f *fakeDB, node string, steps []step) *Worker {
+	db := f.open()
+	return &Worker{db: db, node: node, interval: time.Minute, steps: steps, authz: authz.NewCache(db, cluster.NewLocalBus(), time.Minute)}
+}
+
+func (f *fakeDB) schedule(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	f.jobs[userID] = &fakeJob{status: StatusPending, requestedAt: now, scheduledFor: now.Add(-time.Second)}
+}
+
+func (f *fakeDB) expireLease(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	past := time.Now().Add(-time.Second)
+	f.jobs[userID].leaseUntil = &past
+}
+
+func TestRunResumesAfterFailedStep(t *testing.T) {
+	f := newFakeDB()
+	f.schedule("u1")
+	calls := &stepLog{fail: map[string]int{"b": 1}}
+	w := testWorker(f, "n1", calls.steps("a", "b", "c"))
+
+	if err := w.RunDue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.take(); got != "n1:a,n1:b" {
+		t.Fatalf("first run = %s", got)
+	}
+	j := f.job("u1")
+	if j.status != StatusRunning || j.step != "a" || j.lastError != "b: boom" || j.attempts != 1 {
+		t.Fatalf("after failure = %+v", j)
+	}
+	if j.leaseUntil == nil || !j.leaseUntil.After(time.Now()) {
+		t.Fatalf("failed step not backed off: %v", j.leaseUntil)
+	}
+	if err := w.RunDue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.take(); got != "" {
+		t.Fatalf("retried before the backoff: %s", got)
+	}
+
+	f.expireLease("u1")
+	if err := w.RunDue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.take(); got != "n1:b,n1:c" {
+		t.Fatalf("resumed run = %s", got)
+	}
+	j = f.job("u1")
+	if j.status != StatusDone || j.completedAt == nil || j.lastError != "" || j.leaseUntil != nil {
+		t.Fatalf("after completion = %+v", j)
+	}
+}
+
+func TestRunFailsAfterMaxAttempts(t *testing.T) {
+	f := newFakeDB()
+	f.schedule("u1")
+	calls := &stepLog{fail: map[string]int{"a": maxAttempts + 1}}
+	w := testWorker(f, "n1", calls.steps("a", "b"))
+
+	for i := 0; i < maxAttempts; i++ {
+		if err := w.RunDue(); err != nil {
+			t.Fatal(err)
+		}
+		if i < maxAttempts-1 {
+			f.expireLease("u1")
+		}
+	}
+	if got := calls.take(); got != strings.TrimSuffix(strings.Repeat("n1:a,", maxAttempts), ",") {
+		t.Fatalf("runs = %s", got)
+	}
+	j := f.job("u1")
+	if j.status != StatusFailed || j.leaseUntil != nil || j.attempts != maxAttempts {
+		t.Fatalf("after last attempt = %+v", j)
+	}
+	if err := w.RunDue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.take(); got != "" {
+		t.Fatalf("failed job ran again: %s", got)
+	}
+
+	job, err := Get(w.db, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusFailed || job.LastError != "a: boom" || job.Attempts != maxAttempts {
+		t.Fatalf("job = %+v", job)
+	}
+	if cancelled, err := Cancel(w.db, "u1"); err != nil || !cancelled {
+		t.Fatalf("Cancel(failed before any step) = %v, %v", cancelled, err)
+	}
+}
+
+func TestLeaseTakeover(t *testing.T) {
+	f := newFakeDB()
+	f.schedule("u1")
+	calls := &stepLog{}
+	a := testWorker(f, "node-a", calls.steps("a", "b", "c"))
+	b := testWorker(f, "node-b", calls.steps("a", "b", "c"))
+
+	if claimed, err := a.claim("u1"); err != nil || !claimed {
+		t.Fatalf("node-a claim = %v, %v", claimed, err)
+	}
+	if _, err := a.owned(`UPDATE account_deletions SET step = ?, lease_until = ? WHERE user_id = ? AND claimed_by = ?`,
+		"a", time.Now().Add(lease), "u1", "node-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RunDue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.take(); got != "" {
+		t.Fatalf("node-b ran a leased job: %s", got)
+	}
+
+	f.expireLease("u1")
+	if claimed, err := b.claim("u1"); err != nil || !claimed {
+		t.Fatalf("node-b takeover = %v, %v", claimed, err)
+	}
+	a.run("u1")
+	if got := calls.take(); got != "node-a:b" {
+		t.Fatalf("stale owner runs = %s", got)
+	}
+	if j := f.job("u1"); j.claimedBy != "node-b" || j.step != "a" || j.attempts != 2 {
+		t.Fatalf("stale owner changed the job: %+v", j)
+	}
+
+	b.run("u1")
+	if got := calls.take(); got != "node-b:b,node-b:c" {
+		t.Fatalf("new owner runs = %s", got)
+	}
+	if j := f.job("u1"); j.status != StatusDone {
+		t.Fatalf("job = %+v", j)
+	}
+}
+
+func TestCancelRacesClaim(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		f := newFakeDB()
+		f.schedule("u1")
+		w := testWorker(f, "n1", nil)
+
+		var cancelled, claimed bool
+		var cancelErr, claimErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancelled, cancelErr = Cancel(w.db, "u1")
+		}()
+		go func() {
+			defer wg.Done()
+			claimed, claimErr = w.claim("u1")
+		}()
+		wg.Wait()
+
+		if claimErr != nil {
+			t.Fatal(claimErr)
+		}
+		if cancelled == claimed {
+			t.Fatalf("cancelled = %v, claimed = %v", cancelled, claimed)
+		}
+		j := f.job("u1")
+		if claimed && (cancelErr != ErrNotCancellable || j.status != StatusRunning) {
+			t.Fatalf("claim won but Cancel = %v, status = %s", cancelErr, j.status)
+		}
+		if cancelled && (cancelErr != nil || j.status != StatusCancelled) {
+			t.Fatalf("cancel won but err = %v, status = %s", cancelErr, j.status)
+		}
+	}
+}
+
+func TestLeaveGroups(t *testing.T) {
+	f := newFakeDB()
+	t0 := time.Now().Add(-time.Hour)
+	f.owners["owned"] = "u1"
+	f.addMember("owned", "u1", "owner", t0)
+	f.addMember("owned", "u3", "member", t0.Add(2*time.Minute))
+	f.addMember("owned", "u2", "member", t0.Add(time.Minute))
+	f.addMember("owned", "u4", "member", t0.Add(time.Minute))
+	f.owners["alone"] = "u1"
+	f.addMember("alone", "u1", "owner", t0)
+	f.owners["joined"] = "u5"
+	f.addMember("joined", "u5", "owner", t0)
+	f.addMember("joined", "u1", "member", t0)
+	w := testWorker(f, "n1", nil)
+
+	if err := w.leaveGroups("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if owner := f.owners["owned"]; owner != "u2" {
+		t.Errorf("owned group owner = %s, want u2", owner)
+	}
+	if got := strings.Join(f.groupMembers("owned"), ","); got != "u3:member,u2:owner,u4:member" {
+		t.Errorf("owned group members = %s", got)
+	}
+	if _, ok := f.owners["alone"]; ok {
+		t.Error("empty group was not deleted")
+	}
+	if got := f.groupMembers("alone"); len(got) != 0 {
+		t.Errorf("empty group members = %v", got)
+	}
+	if owner := f.owners["joined"]; owner != "u5" {
+		t.Errorf("joined group owner = %s, want u5", owner)
+	}
+	if got := strings.Join(f.groupMembers("joined"), ","); got != "u5:owner" {
+		t.Errorf("joined group members = %s", got)
+	}
+}
@@ -0,0 +1,272 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fakeJob struct {
+	status       string
+	step         string
+	requestedAt  time.Time
+	scheduledFor time.Time
+	claimedBy    string
+	leaseUntil   *time.Time
+	attempts     int
+	lastError    string
+	completedAt  *time.Time
+}
+
+type fakeMember struct {
+	id        int
+	groupID   string
+	userID    string
+	role      string
+	createdAt time.Time
+}
+
+type fakeDB struct {
+	mu      sync.Mutex
+	jobs    map[string]*fakeJob
+	owners  map[string]string
+	members []*fakeMember
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{jobs: map[string]*fakeJob{}, owners: map[string]string{}}
+}
+
+func (f *fakeDB) open() *sql.DB {
+	return sql.OpenDB(fakeConnector{f})
+}
+
+func (f *fakeDB) job(userID string) fakeJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.jobs[userID]
+}
+
+func (f *fakeDB) addMember(groupID, userID, role string, createdAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members = append(f.members, &fakeMember{id: len(f.members) + 1, groupID: groupID, userID: userID, role: role, createdAt: createdAt})
+}
+
+func (f *fakeDB) groupMembers(groupID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, m := range f.members {
+		if m.groupID == groupID {
+			out = append(out, m.userID+":"+m.role)
+		}
+	}
+	return out
+}
+
+func due(j *fakeJob, now time.Time) bool {
+	return (j.status == StatusPending || j.status == StatusRunning) && !j.scheduledFor.After(now) &&
+		(j.leaseUntil == nil || j.leaseUntil.Before(now))
+}
+
+func timePtr(v driver.Value) *time.Time {
+	if v == nil {
+		return nil
+	}
+	t := v.(time.Time)
+	return &t
+}
+
+func (f *fakeDB) exec(query string, args []driver.Value) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	str := func(i int) string { return args[i].(string) }
+	switch {
+	case strings.HasPrefix(query, "UPDATE account_deletions SET status = ?, claimed_by = ?"):
+		j := f.jobs[str(3)]
+		if j == nil || !due(j, args[4].(time.Time)) {
+			return 0, nil
+		}
+		j.status, j.claimedBy, j.leaseUntil = str(0), str(1), timePtr(args[2])
+		j.attempts++
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE account_deletions SET step = ?"):
+		j := f.jobs[str(2)]
+		if j == nil || j.claimedBy != str(3) {
+			return 0, nil
+		}
+		j.step, j.leaseUntil = str(0), timePtr(args[1])
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE account_deletions SET status = ?, completed_at = ?"):
+		j := f.jobs[str(2)]
+		if j == nil || j.claimedBy != str(3) {
+			return 0, nil
+		}
+		j.status, j.completedAt, j.leaseUntil, j.lastError = str(0), timePtr(args[1]), nil, ""
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE account_deletions SET status = ?, lease_until = ?, last_error = ?"):
+		j := f.jobs[str(3)]
+		if j == nil || j.claimedBy != str(4) {
+			return 0, nil
+		}
+		j.status, j.leaseUntil, j.lastError = str(0), timePtr(args[1]), str(2)
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE account_deletions SET status = ? WHERE user_id = ? AND status IN ('pending', 'failed') AND step = ''"):
+		j := f.jobs[str(1)]
+		if j == nil || (j.status != StatusPending && j.status != StatusFailed) || j.step != "" {
+			return 0, nil
+		}
+		j.status = str(0)
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE `groups` SET owner_user_id = ?"):
+		f.owners[str(1)] = str(0)
+		return 1, nil
+	case strings.HasPrefix(query, "UPDATE `group_members` SET role = 'owner'"):
+		for _, m := range f.members {
+			if m.groupID == str(0) && m.userID == str(1) {
+				m.role = "owner"
+			}
+		}
+		return 1, nil
+	case strings.HasPrefix(query, "DELETE FROM `groups` WHERE group_id = ?"):
+		delete(f.owners, str(0))
+		return 1, nil
+	case strings.HasPrefix(query, "DELETE FROM `group_members` WHERE group_id = ? AND user_id = ?"):
+		kept := f.members[:0]
+		for _, m := range f.members {
+			if m.groupID != str(0) || m.userID != str(1) {
+				kept = append(kept, m)
+			}
+		}
+		f.members = kept
+		return 1, nil
+	}
+	return 0, fmt.Errorf("fakedb: unexpected exec %q", query)
+}
+
+func (f *fakeDB) query(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	str := func(i int) string { return args[i].(string) }
+	switch {
+	case strings.HasPrefix(query, "SELECT user_id, status, step"):
+		j := f.jobs[str(0)]
+		if j == nil {
+			return []string{"user_id"}, nil, nil
+		}
+		var completedAt driver.Value
+		if j.completedAt != nil {
+			completedAt = *j.completedAt
+		}
+		return []string{"user_id", "status", "step", "requested_at", "scheduled_for", "completed_at", "attempts", "last_error"},
+			[][]driver.Value{{str(0), j.status, j.step, j.requestedAt, j.scheduledFor, completedAt, int64(j.attempts), j.lastError}}, nil
+	case strings.HasPrefix(query, "SELECT user_id FROM account_deletions"):
+		var ids []string
+		for id, j := range f.jobs {
+			if due(j, args[0].(time.Time)) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		var rows [][]driver.Value
+		for _, id := range ids {
+			rows = append(rows, []driver.Value{id})
+		}
+		return []string{"user_id"}, rows, nil
+	case strings.HasPrefix(query, "SELECT group_id FROM `group_members` WHERE user_id = ?"):
+		var rows [][]driver.Value
+		for _, m := range f.members {
+			if m.userID == str(0) {
+				rows = append(rows, []driver.Value{m.groupID})
+			}
+		}
+		return []string{"group_id"}, rows, nil
+	case strings.HasPrefix(query, "SELECT owner_user_id FROM `groups` WHERE group_id = ?"):
+		owner, ok := f.owners[str(0)]
+		if !ok {
+			return []string{"owner_user_id"}, nil, nil
+		}
+		return []string{"owner_user_id"}, [][]driver.Value{{owner}}, nil
+	case strings.HasPrefix(query, "SELECT user_id FROM `group_members` WHERE group_id = ? AND user_id <> ?"):
+		var heir *fakeMember
+		for _, m := range f.members {
+			if m.groupID != str(0) || m.userID == str(1) {
+				continue
+			}
+			if heir == nil || m.createdAt.Before(heir.createdAt) || (m.createdAt.Equal(heir.createdAt) && m.id < heir.id) {
+				heir = m
+			}
+		}
+		if heir == nil {
+			return []string{"user_id"}, nil, nil
+		}
+		return []string{"user_id"}, [][]driver.Value{{heir.userID}}, nil
+	}
+	return nil, nil, fmt.Errorf("fakedb: unexpected query %q", query)
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{db: c.db, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, err := s.db.exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	cols, rows, err := s.db.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
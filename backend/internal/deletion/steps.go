@@ -0,0 +1,215 @@
+package deletion
+
+import (
+	"database/sql"
+	"time"
+
+	"p2p-chat-app/backend/internal/presence"
+	"p2p-chat-app/backend/internal/session"
+)
+
+func (w *Worker) revokeAccess(userID string) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	accounts, err := queryStrings(tx, `
+		SELECT user_id FROM service_accounts WHERE owner_user_id = ? AND disabled_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := session.RevokeAll(tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM ws_tickets WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE api_keys SET revoked_at = ?
+		WHERE revoked_at IS NULL AND user_id IN (SELECT user_id FROM service_accounts WHERE owner_user_id = ?)
+	`, now, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE service_accounts SET disabled_at = ? WHERE owner_user_id = ? AND disabled_at IS NULL
+	`, now, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	w.sessions.Publish(session.Revocation{UserID: userID})
+	for _, id := range accounts {
+		w.sessions.Publish(session.Revocation{UserID: id})
+	}
+	return nil
+}
+
+func (w *Worker) leaveGroups(userID string) error {
+	groups, err := queryStrings(w.db, "SELECT group_id FROM `group_members` WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	for _, groupID := range groups {
+		if err := w.leaveGroup(groupID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) leaveGroup(groupID, userID string) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID string
+	err = tx.QueryRow("SELECT owner_user_id FROM `groups` WHERE group_id = ? FOR UPDATE", groupID).Scan(&ownerID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	members := []string{userID}
+	if ownerID == userID {
+		var heir string
+		err = tx.QueryRow(
+			"SELECT user_id FROM `group_members` WHERE group_id = ? AND user_id <> ? ORDER BY created_at ASC, id ASC LIMIT 1",
+			groupID, userID,
+		).Scan(&heir)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := tx.Exec("DELETE FROM `groups` WHERE group_id = ?", groupID); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if _, err := tx.Exec("UPDATE `groups` SET owner_user_id = ? WHERE group_id = ?", heir, groupID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE `group_members` SET role = 'owner' WHERE group_id = ? AND user_id = ?", groupID, heir); err != nil {
+				return err
+			}
+			members = append(members, heir)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM `group_members` WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, id := range members {
+		w.authz.InvalidateMembership(groupID, id)
+	}
+	return nil
+}
+
+func (w *Worker) removeFriends(userID string) error {
+	friends, err := queryStrings(w.db, `
+		SELECT friend_user_id FROM friends WHERE user_id = ?
+		UNION
+		SELECT user_id FROM friends WHERE friend_user_id = ?
+	`, userID, userID)
+	if err != nil {
+		return err
+	}
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM friends WHERE user_id = ? OR friend_user_id = ?`, userID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM friend_requests WHERE from_user_id = ? OR to_user_id = ?`, userID, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, id := range friends {
+		w.authz.InvalidateFriendship(userID, id)
+	}
+	return nil
+}
+
+func (w *Worker) clearPresence(userID string) error {
+	if _, _, err := w.presence.Update(userID, func(s *presence.State) bool {
+		*s = presence.Offline(userID)
+		return true
+	}); err != nil {
+		return err
+	}
+	if err := w.presence.Flush(); err != nil {
+		return err
+	}
+	for _, q := range []string{
+		`DELETE FROM presence WHERE user_id = ?`,
+		`DELETE FROM presence_privacy WHERE user_id = ?`,
+		`DELETE FROM ice_policies WHERE user_id = ?`,
+	} {
+		if _, err := w.db.Exec(q, userID); err != nil {
+			return err
+		}
+	}
+	_, err := w.db.Exec(`DELETE FROM presence_hidden_from WHERE user_id = ? OR hidden_from_user_id = ?`, userID, userID)
+	return err
+}
+
+func (w *Worker) deleteCredentials(userID string) error {
+	for _, q := range []string{
+		`DELETE FROM user_mfa WHERE user_id = ?`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = ?`,
+		`DELETE FROM user_identities WHERE user_id = ?`,
+		`DELETE FROM oidc_states WHERE link_user_id = ?`,
+		`DELETE FROM password_resets WHERE user_id = ?`,
+		`DELETE FROM sessions WHERE user_id = ?`,
+	} {
+		if _, err := w.db.Exec(q, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) deleteProfile(userID string) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE login_audit SET user_id = NULL, username = '' WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryStrings(q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
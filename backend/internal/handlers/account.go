@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/deletion"
+	"p2p-chat-app/backend/internal/lockout"
+	"p2p-chat-app/backend/pkg/utils"
+)
+
+const maxExportLoginHistory = 1000
+
+type AccountHandler struct {
+	DB            *sql.DB
+	Auth          *AuthHandler
+	DeletionGrace time.Duration
+}
+
+type deleteAccountRequest struct {
+	Confirm  string `json:"confirm" binding:"required"`
+	Password string `json:"password" binding:"max=72"`
+	Code     string `json:"code" binding:"max=16"`
+}
+
+type exportSection struct {
+	name   string
+	single bool
+	params int
+	query  string
+}
+
+var exportSections = []exportSection{
+	{"profile", true, 1, `
+		SELECT u.user_id AS userId, u.username, u.created_at AS createdAt,
+			COALESCE(m.enabled, 0) AS mfaEnabled
+		FROM users u LEFT JOIN user_mfa m ON m.user_id = u.user_id
+		WHERE u.user_id = ?`},
+	{"friends", false, 1, `
+		SELECT f.friend_user_id AS userId, u.username, f.created_at AS since
+		FROM friends f LEFT JOIN users u ON u.user_id = f.friend_user_id
+		WHERE f.user_id = ?
+		ORDER BY f.created_at`},
+	{"friend_requests", false, 2, `
+		SELECT r.from_user_id AS fromUserId, fu.username AS fromUsername,
+			r.to_user_id AS toUserId, tu.username AS toUsername, r.status, r.created_at AS createdAt
+		FROM friend_requests r
+		LEFT JOIN users fu ON fu.user_id = r.from_user_id
+		LEFT JOIN users tu ON tu.user_id = r.to_user_id
+		WHERE r.from_user_id = ? OR r.to_user_id = ?
+		ORDER BY r.created_at`},
+	{"groups", false, 1, "SELECT g.group_id AS groupId, g.name, g.owner_user_id AS ownerUserId, gm.role, gm.created_at AS joinedAt " +
+		"FROM `group_members` gm JOIN `groups` g ON g.group_id = gm.group_id " +
+		"WHERE gm.user_id = ? ORDER BY gm.created_at"},
+	{"sessions", false, 1, `
+		SELECT session_id AS id, device_name AS deviceName, platform, user_agent AS userAgent,
+			last_ip AS lastIp, last_active_at AS lastActiveAt, created_at AS createdAt,
+			expires_at AS expiresAt, revoked_at AS revokedAt
+		FROM sessions WHERE user_id = ?
+		ORDER BY created_at`},
+	{"identities", false, 1, `
+		SELECT provider, email, created_at AS createdAt, last_login_at AS lastLoginAt
+		FROM user_identities WHERE user_id = ?`},
+	{"presence_settings", true, 1, `
+		SELECT p.last_seen_visibility AS lastSeenVisibility, p.hide_from_groups AS hideFromGroups,
+			i.hide_host AS hideHost, i.hide_srflx AS hideSrflx, i.relay_only_for_non_friends AS relayOnlyForNonFriends
+		FROM users u
+		LEFT JOIN presence_privacy p ON p.user_id = u.user_id
+		LEFT JOIN ice_policies i ON i.user_id = u.user_id
+		WHERE u.user_id = ?`},
+	{"service_accounts", false, 1, `
+		SELECT s.user_id AS id, s.name, s.created_at AS createdAt, s.disabled_at AS disabledAt
+		FROM service_accounts s WHERE s.owner_user_id = ?`},
+	{"login_history", false, 1, `
+		SELECT client_ip AS clientIp, user_agent AS userAgent, outcome, created_at AS createdAt
+		FROM login_audit WHERE user_id = ?
+		ORDER BY created_at DESC LIMIT ` + strconv.Itoa(maxExportLoginHistory)},
+}
+
+func (h *AccountHandler) Export(c *gin.Context) {
+	userID := c.GetString("userId")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	data := make(map[string]interface{}, len(exportSections)+1)
+	data["exported_at"] = time.Now().UTC()
+	for _, section := range exportSections {
+		args := make([]interface{}, section.params)
+		for i := range args {
+			args[i] = userID
+		}
+		rows, err := queryMaps(h.DB, section.query, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if section.single {
+			data[section.name] = nil
+			if len(rows) > 0 {
+				data[section.name] = rows[0]
+			}
+			continue
+		}
+		data[section.name] = rows
+	}
+
+	filename := "p2p-chat-export-" + time.Now().UTC().Format("20060102")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, data)
+		return
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	c.Status(http.StatusOK)
+	zw := zip.NewWriter(c.Writer)
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := zw.Create(name + ".json")
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data[name]); err != nil {
+			return
+		}
+	}
+	_ = zw.Close()
+}
+
+func (h *AccountHandler) Delete(c *gin.Context) {
+	var req deleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if req.Password == "" && req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password or 2fa code required"})
+		return
+	}
+	userID := c.GetString("userId")
+	var username, passwordHash string
+	if err := h.DB.QueryRow("SELECT username, password_hash FROM users WHERE user_id = ?", userID).Scan(&username, &passwordHash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if req.Confirm != username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirm must match your username"})
+		return
+	}
+	if !h.Auth.reauthenticate(c, userID, username, passwordHash, req.Password, req.Code) {
+		return
+	}
+	job, err := deletion.Schedule(h.DB, userID, h.DeletionGrace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *AccountHandler) DeletionStatus(c *gin.Context) {
+	job, err := deletion.Get(h.DB, c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if job == nil || job.Status == deletion.StatusCancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deletion scheduled"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	cancelled, err := deletion.Cancel(h.DB, c.GetString("userId"))
+	if err == deletion.ErrNotCancellable {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deletion scheduled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
+
+func queryMaps(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+func (h *AuthHandler) reauthenticate(c *gin.Context, userID, username, passwordHash, password, code string) bool {
+	attempt := lockout.Attempt{
+		Username:  username,
+		UserID:    userID,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if h.throttled(c, attempt) {
+		return false
+	}
+	if code != "" {
+		state, err := h.loadMFA(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return false
+		}
+		if state == nil || !state.enabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "2fa not enabled"})
+			return false
+		}
+		ok, err := h.consumeTOTP(userID, state, code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return false
+		}
+		if !ok {
+			if err := h.Guard.Fail(attempt, lockout.OutcomeBadMFACode); err != nil {
+				log.Printf("login failure tracking error: %v", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+			return false
+		}
+	} else if passwordHash == "" || !utils.CheckPassword(password, passwordHash) {
+		h.loginFailed(c, attempt, lockout.OutcomeBadPassword)
+		return false
+	}
+	if err := h.Guard.Succeed(attempt); err != nil {
+		log.Printf("login throttle reset error: %v", err)
+	}
+	return true
+}
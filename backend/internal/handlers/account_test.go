@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeleteRequiresReauthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &AccountHandler{Auth: &AuthHandler{}}
+	for _, body := range []string{`{"confirm":"alice"}`, `{"confirm":"alice","password":"","code":""}`} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/users/me", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userId", "u1")
+		h.Delete(c)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "password or 2fa code required") {
+			t.Errorf("%s: status = %d, body = %s", body, w.Code, w.Body.String())
+		}
+	}
+}
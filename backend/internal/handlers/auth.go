@@ -2,17 +2,38 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"p2p-chat-app/backend/internal/lockout"
+	"p2p-chat-app/backend/internal/notify"
+	"p2p-chat-app/backend/internal/oidc"
+	"p2p-chat-app/backend/internal/session"
+	"p2p-chat-app/backend/internal/tokens"
 	"p2p-chat-app/backend/pkg/utils"
 )
 
+const (
+	tokenTTL          = 24 * time.Hour
+	legacyHashRefresh = 10 * time.Minute
+)
+
 type AuthHandler struct {
 	DB        *sql.DB
-	JWTSecret string
+	Tokens    *tokens.Manager
+	Sessions  *session.Revocations
+	Guard     *lockout.Guard
+	Notifier  notify.Notifier
+	ResetTTL  time.Duration
+	MFAIssuer string
+
+	Providers            map[string]*oidc.Provider
+	DisablePasswordLogin bool
 }
 
 type registerRequest struct {
@@ -31,6 +52,10 @@ type authResponse struct {
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
+	if h.DisablePasswordLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "password sign-up is disabled"})
+		return
+	}
 	var req registerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
@@ -60,9 +85,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateToken(userID, h.JWTSecret, 24*time.Hour)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+	token, ok := h.issueToken(c, userID)
+	if !ok {
 		return
 	}
 
@@ -70,32 +94,159 @@ func (h *AuthHandler) Register(c *gin.Context) {
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
+	if h.DisablePasswordLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "password login is disabled"})
+		return
+	}
 	var req loginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
 
+	attempt := lockout.Attempt{
+		Username:  req.Username,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if h.throttled(c, attempt) {
+		return
+	}
+
 	var userID, passwordHash string
 	err := h.DB.QueryRow("SELECT user_id, password_hash FROM users WHERE username = ?", req.Username).Scan(&userID, &passwordHash)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	if err == sql.ErrNoRows || passwordHash == "" {
+		utils.CheckDummyPassword(req.Username, req.Password)
+		h.loginFailed(c, attempt, lockout.OutcomeUnknownUser)
+		return
+	}
+	attempt.UserID = userID
+	if !utils.CheckPassword(req.Password, passwordHash) {
+		h.loginFailed(c, attempt, lockout.OutcomeBadPassword)
+		return
+	}
+	if utils.NeedsRehash(passwordHash) {
+		h.rehash(userID, req.Password)
+	}
+	enabled, err := mfaEnabled(h.DB, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
-	if !utils.CheckPassword(req.Password, passwordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if enabled {
+		challenge, err := h.Tokens.IssueChallenge(userID, mfaChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, mfaChallengeResponse{MFARequired: true, ChallengeToken: challenge})
 		return
 	}
+	if err := h.Guard.Succeed(attempt); err != nil {
+		log.Printf("login throttle reset error: %v", err)
+	}
 
-	token, err := utils.GenerateToken(userID, h.JWTSecret, 24*time.Hour)
+	token, ok := h.issueToken(c, userID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, authResponse{UserID: userID, AccessToken: token})
+}
+
+func (h *AuthHandler) issueToken(c *gin.Context, userID string) (string, bool) {
+	var deleting int
+	err := h.DB.QueryRow(`
+		SELECT 1 FROM account_deletions WHERE user_id = ? AND status = 'running'
+	`, userID).Scan(&deleting)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return "", false
+	}
+	if err == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is being deleted"})
+		return "", false
+	}
+	sessionID, err := session.Create(h.DB, userID, tokenTTL, session.NewDevice(c.GetHeader("X-Device-Name"), c.Request.UserAgent(), c.ClientIP()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return "", false
+	}
+	token, err := h.Tokens.Issue(userID, sessionID, tokenTTL)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		return "", false
+	}
+	return token, true
+}
+
+func (h *AuthHandler) rehash(userID, password string) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("password rehash error: %v", err)
 		return
 	}
+	if _, err := h.DB.Exec("UPDATE users SET password_hash = ? WHERE user_id = ?", hash, userID); err != nil {
+		log.Printf("password rehash error: %v", err)
+	}
+}
 
-	c.JSON(http.StatusOK, authResponse{UserID: userID, AccessToken: token})
+func (h *AuthHandler) TrackLegacyHashes() {
+	h.refreshLegacyHashes()
+	go func() {
+		ticker := time.NewTicker(legacyHashRefresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.refreshLegacyHashes()
+		}
+	}()
+}
+
+func (h *AuthHandler) refreshLegacyHashes() {
+	var total, legacy int
+	var sample sql.NullString
+	err := h.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(password_hash NOT LIKE '$argon2id$%'), 0),
+			MAX(CASE WHEN password_hash NOT LIKE '$argon2id$%' THEN password_hash END)
+		FROM users WHERE password_hash <> ''
+	`).Scan(&total, &legacy, &sample)
+	if err != nil {
+		log.Printf("legacy hash scan error: %v", err)
+		return
+	}
+	share := 0.0
+	if total > 0 {
+		share = float64(legacy) / float64(total)
+	}
+	if err := utils.SetLegacyHashProfile(share, sample.String); err != nil {
+		log.Printf("legacy hash profile error: %v", err)
+	}
+}
+
+func (h *AuthHandler) throttled(c *gin.Context, attempt lockout.Attempt) bool {
+	wait, err := h.Guard.Check(attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return true
+	}
+	if wait > 0 {
+		if err := h.Guard.Throttled(attempt); err != nil {
+			log.Printf("login audit error: %v", err)
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts"})
+		return true
+	}
+	return false
+}
+
+func (h *AuthHandler) loginFailed(c *gin.Context, attempt lockout.Attempt, outcome string) {
+	if err := h.Guard.Fail(attempt, outcome); err != nil {
+		log.Printf("login failure tracking error: %v", err)
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 }
@@ -5,10 +5,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/authz"
 )
 
 type FriendsHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Authz *authz.Cache
 }
 
 type friendRequestInput struct {
@@ -19,6 +21,10 @@ type friendAcceptInput struct {
 	FromUserID string `json:"fromUserId" binding:"required"`
 }
 
+type friendRemoveInput struct {
+	UserID string `json:"userId" binding:"required"`
+}
+
 type friendListItem struct {
 	UserID string `json:"userId"`
 	Username string `json:"username"`
@@ -106,9 +112,55 @@ func (h *FriendsHandler) Accept(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	h.Authz.InvalidateFriendship(req.FromUserID, toUserID)
 	c.JSON(http.StatusOK, gin.H{"status": "accepted"})
 }
 
+func (h *FriendsHandler) Remove(c *gin.Context) {
+	var req friendRemoveInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		DELETE FROM friends
+		WHERE (user_id = ? AND friend_user_id = ?) OR (user_id = ? AND friend_user_id = ?)
+	`, userID, req.UserID, req.UserID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not friends"})
+		return
+	}
+	_, err = tx.Exec(`
+		DELETE FROM friend_requests
+		WHERE (from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)
+	`, userID, req.UserID, req.UserID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	h.Authz.InvalidateFriendship(userID, req.UserID)
+	c.JSON(http.StatusOK, gin.H{"status": "removed"})
+}
+
 func (h *FriendsHandler) Requests(c *gin.Context) {
 	userID := c.GetString("userId")
 	rows, err := h.DB.Query(`
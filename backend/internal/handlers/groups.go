@@ -6,10 +6,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"p2p-chat-app/backend/internal/authz"
 )
 
 type GroupsHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Authz *authz.Cache
 }
 
 type createGroupInput struct {
@@ -68,6 +70,7 @@ func (h *GroupsHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	h.Authz.InvalidateMembership(groupID, ownerID)
 
 	c.JSON(http.StatusCreated, gin.H{"groupId": groupID})
 }
@@ -96,6 +99,7 @@ func (h *GroupsHandler) Invite(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	h.Authz.InvalidateMembership(req.GroupID, req.UserID)
 	c.JSON(http.StatusOK, gin.H{"status": "invited"})
 }
 
@@ -133,6 +137,7 @@ func (h *GroupsHandler) Leave(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	h.Authz.InvalidateMembership(req.GroupID, userID)
 	c.JSON(http.StatusOK, gin.H{"status": "left"})
 }
 
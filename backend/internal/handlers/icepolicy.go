@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/icepolicy"
+)
+
+type ICEPolicyHandler struct {
+	Store *icepolicy.Store
+}
+
+func (h *ICEPolicyHandler) Get(c *gin.Context) {
+	p, err := h.Store.Get(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *ICEPolicyHandler) Update(c *gin.Context) {
+	var req icepolicy.Policy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if err := h.Store.Set(c.GetString("userId"), req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
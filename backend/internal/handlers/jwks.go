@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/tokens"
+)
+
+type JWKSHandler struct {
+	Tokens *tokens.Manager
+}
+
+func (h *JWKSHandler) Get(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.Tokens.JWKS()})
+}
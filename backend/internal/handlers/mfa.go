@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/lockout"
+	"p2p-chat-app/backend/pkg/utils"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
+type mfaVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"`
+}
+
+type mfaEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+type mfaStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type mfaState struct {
+	secret      string
+	enabled     bool
+	lastCounter int64
+}
+
+func (h *AuthHandler) MFAStatus(c *gin.Context) {
+	userID := c.GetString("userId")
+	state, err := h.loadMFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	resp := mfaStatusResponse{Enabled: state != nil && state.enabled}
+	if resp.Enabled {
+		err := h.DB.QueryRow(`
+			SELECT COUNT(1) FROM mfa_recovery_codes
+			WHERE user_id = ? AND used_at IS NULL
+		`, userID).Scan(&resp.RecoveryCodesRemaining)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	userID := c.GetString("userId")
+	state, err := h.loadMFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state != nil && state.enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+	var username string
+	if err := h.DB.QueryRow("SELECT username FROM users WHERE user_id = ?", userID).Scan(&username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "secret generation failed"})
+		return
+	}
+	sealed, err := h.Tokens.SealSecret(mfaSecretAAD(userID), secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "secret generation failed"})
+		return
+	}
+	res, err := h.DB.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret, enabled, last_counter)
+		VALUES (?, ?, 0, 0)
+		ON DUPLICATE KEY UPDATE
+			totp_secret = IF(enabled = 0, VALUES(totp_secret), totp_secret),
+			last_counter = IF(enabled = 0, 0, last_counter)
+	`, userID, sealed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, mfaEnrollResponse{Secret: secret, URI: utils.TOTPURI(h.MFAIssuer, username, secret)})
+}
+
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+	state, err := h.loadMFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state == nil || state.enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "no pending 2fa enrollment"})
+		return
+	}
+	counter, ok := utils.VerifyTOTP(state.secret, req.Code, time.Now(), state.lastCounter)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "recovery code generation failed"})
+		return
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE user_mfa SET enabled = 1, enabled_at = ?, last_counter = ?
+		WHERE user_id = ? AND enabled = 0
+	`, time.Now(), counter, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	for _, code := range codes {
+		_, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, userID, hashRecoveryCode(userID, code))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+	state, err := h.loadMFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state == nil || !state.enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "2fa not enabled"})
+		return
+	}
+	var username string
+	if err := h.DB.QueryRow("SELECT username FROM users WHERE user_id = ?", userID).Scan(&username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	attempt := lockout.Attempt{
+		Username:  username,
+		UserID:    userID,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if h.throttled(c, attempt) {
+		return
+	}
+	ok, err := h.consumeTOTP(userID, state, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		if err := h.Guard.Fail(attempt, lockout.OutcomeBadMFACode); err != nil {
+			log.Printf("login failure tracking error: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err := h.Guard.Succeed(attempt); err != nil {
+		log.Printf("login throttle reset error: %v", err)
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req mfaVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	claims, err := h.Tokens.ParseChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid challenge"})
+		return
+	}
+	userID := claims.UserID
+
+	var username string
+	if err := h.DB.QueryRow("SELECT username FROM users WHERE user_id = ?", userID).Scan(&username); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid challenge"})
+		return
+	}
+	attempt := lockout.Attempt{
+		Username:  username,
+		UserID:    userID,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if h.throttled(c, attempt) {
+		return
+	}
+
+	state, err := h.loadMFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state == nil || !state.enabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid challenge"})
+		return
+	}
+	var ok bool
+	if req.Code != "" {
+		ok, err = h.consumeTOTP(userID, state, req.Code)
+	} else {
+		ok, err = h.consumeRecoveryCode(userID, req.RecoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		if err := h.Guard.Fail(attempt, lockout.OutcomeBadMFACode); err != nil {
+			log.Printf("login failure tracking error: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err := h.Guard.Succeed(attempt); err != nil {
+		log.Printf("login throttle reset error: %v", err)
+	}
+
+	token, ok := h.issueToken(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, authResponse{UserID: userID, AccessToken: token})
+}
+
+func (h *AuthHandler) consumeTOTP(userID string, state *mfaState, code string) (bool, error) {
+	counter, ok := utils.VerifyTOTP(state.secret, code, time.Now(), state.lastCounter)
+	if !ok {
+		return false, nil
+	}
+	res, err := h.DB.Exec(`
+		UPDATE user_mfa SET last_counter = ?
+		WHERE user_id = ? AND last_counter < ?
+	`, counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+func (h *AuthHandler) consumeRecoveryCode(userID, code string) (bool, error) {
+	res, err := h.DB.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now(), userID, hashRecoveryCode(userID, code))
+	if err != nil {
+		return false, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+func mfaEnabled(db *sql.DB, userID string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT enabled FROM user_mfa WHERE user_id = ?`, userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (h *AuthHandler) loadMFA(userID string) (*mfaState, error) {
+	var state mfaState
+	var stored string
+	err := h.DB.QueryRow(`
+		SELECT totp_secret, enabled, last_counter FROM user_mfa WHERE user_id = ?
+	`, userID).Scan(&stored, &state.enabled, &state.lastCounter)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, sealed, err := h.Tokens.OpenSecret(mfaSecretAAD(userID), stored)
+	if err != nil {
+		return nil, err
+	}
+	if !sealed {
+		h.sealLegacySecret(userID, stored)
+	}
+	state.secret = secret
+	return &state, nil
+}
+
+func (h *AuthHandler) SealLegacyMFASecrets() error {
+	rows, err := h.DB.Query(`SELECT user_id, totp_secret FROM user_mfa WHERE totp_secret NOT LIKE 'enc1:%'`)
+	if err != nil {
+		return err
+	}
+	legacy := make(map[string]string)
+	for rows.Next() {
+		var userID, secret string
+		if err := rows.Scan(&userID, &secret); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[userID] = secret
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for userID, secret := range legacy {
+		h.sealLegacySecret(userID, secret)
+	}
+	if len(legacy) > 0 {
+		log.Printf("sealed %d stored 2fa secrets", len(legacy))
+	}
+	return nil
+}
+
+func (h *AuthHandler) sealLegacySecret(userID, secret string) {
+	sealed, err := h.Tokens.SealSecret(mfaSecretAAD(userID), secret)
+	if err != nil {
+		log.Printf("2fa secret seal error: %v", err)
+		return
+	}
+	if _, err := h.DB.Exec(`
+		UPDATE user_mfa SET totp_secret = ? WHERE user_id = ? AND totp_secret = ?
+	`, sealed, userID, secret); err != nil {
+		log.Printf("2fa secret seal error: %v", err)
+	}
+}
+
+func mfaSecretAAD(userID string) string {
+	return "totp:" + userID
+}
+
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(userID, code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(userID + ":" + normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"p2p-chat-app/backend/internal/oidc"
+)
+
+const (
+	oidcStateTTL        = 10 * time.Minute
+	maxUsernameAttempts = 20
+	mysqlDuplicateEntry = 1062
+)
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type oidcStartResponse struct {
+	URL string `json:"url"`
+}
+
+type identityItem struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+type oidcState struct {
+	provider   string
+	nonce      string
+	verifier   string
+	linkUserID sql.NullString
+	expiresAt  time.Time
+}
+
+func (h *AuthHandler) OIDCProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"providers": names, "passwordLogin": !h.DisablePasswordLogin})
+}
+
+func (h *AuthHandler) StartOIDC(c *gin.Context) {
+	h.startOIDC(c, "")
+}
+
+func (h *AuthHandler) LinkOIDC(c *gin.Context) {
+	h.startOIDC(c, c.GetString("userId"))
+}
+
+func (h *AuthHandler) startOIDC(c *gin.Context, linkUserID string) {
+	provider, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	url, err := provider.AuthURL(c.Request.Context(), state, nonce, oidc.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("oidc discovery error (%s): %v", provider.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	if _, err := h.DB.Exec(`DELETE FROM oidc_states WHERE expires_at < ?`, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	var link interface{}
+	if linkUserID != "" {
+		link = linkUserID
+	}
+	_, err = h.DB.Exec(`
+		INSERT INTO oidc_states (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, hashState(state), provider.Name(), nonce, verifier, link, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, oidcStartResponse{URL: url})
+}
+
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	h.completeOIDC(c, "")
+}
+
+func (h *AuthHandler) OIDCLinkCallback(c *gin.Context) {
+	h.completeOIDC(c, c.GetString("userId"))
+}
+
+func (h *AuthHandler) completeOIDC(c *gin.Context, linkUserID string) {
+	var req oidcCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	provider, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+	state, err := consumeOIDCState(h.DB, req.State)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state == nil || state.provider != provider.Name() || time.Now().After(state.expiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+	if state.linkUserID.String != linkUserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "state belongs to a different session"})
+		return
+	}
+
+	idToken, err := provider.Exchange(c.Request.Context(), req.Code, state.verifier)
+	if err != nil {
+		log.Printf("oidc exchange error (%s): %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization code rejected"})
+		return
+	}
+	ident, err := provider.Verify(c.Request.Context(), idToken, state.nonce)
+	if err != nil {
+		log.Printf("oidc id token error (%s): %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token"})
+		return
+	}
+
+	userID, err := identityOwner(h.DB, ident)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if state.linkUserID.Valid {
+		h.finishLink(c, state.linkUserID.String, userID, ident)
+		return
+	}
+
+	created := false
+	if userID == "" {
+		userID, err = h.provisionUser(ident)
+		if err != nil {
+			log.Printf("oidc provisioning error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		created = true
+	}
+	if _, err := h.DB.Exec(`
+		UPDATE user_identities SET last_login_at = ?, email = ?
+		WHERE provider = ? AND subject = ?
+	`, time.Now(), ident.Email, ident.Provider, ident.Subject); err != nil {
+		log.Printf("oidc identity update error: %v", err)
+	}
+
+	enabled, err := mfaEnabled(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if enabled {
+		challenge, err := h.Tokens.IssueChallenge(userID, mfaChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, mfaChallengeResponse{MFARequired: true, ChallengeToken: challenge})
+		return
+	}
+	token, ok := h.issueToken(c, userID)
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, authResponse{UserID: userID, AccessToken: token})
+}
+
+func (h *AuthHandler) finishLink(c *gin.Context, linkUserID, ownerID string, ident oidc.Identity) {
+	if ownerID == linkUserID {
+		c.JSON(http.StatusOK, gin.H{"status": "linked", "provider": ident.Provider})
+		return
+	}
+	if ownerID != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "identity already linked to another account"})
+		return
+	}
+	_, err := h.DB.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES (?, ?, ?, ?)
+	`, linkUserID, ident.Provider, ident.Subject, ident.Email)
+	if isDuplicate(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "provider already linked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "linked", "provider": ident.Provider})
+}
+
+func (h *AuthHandler) Identities(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT provider, email, created_at, last_login_at
+		FROM user_identities
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer rows.Close()
+
+	items := []identityItem{}
+	for rows.Next() {
+		var item identityItem
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&item.Provider, &item.Email, &item.CreatedAt, &lastLogin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if lastLogin.Valid {
+			item.LastLoginAt = &lastLogin.Time
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID := c.GetString("userId")
+	provider := c.Param("provider")
+
+	var passwordHash string
+	var identities int
+	err := h.DB.QueryRow(`
+		SELECT u.password_hash, (SELECT COUNT(*) FROM user_identities i WHERE i.user_id = u.user_id)
+		FROM users u WHERE u.user_id = ?
+	`, userID).Scan(&passwordHash, &identities)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if identities <= 1 && (passwordHash == "" || h.DisablePasswordLogin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot remove the last sign-in method"})
+		return
+	}
+	res, err := h.DB.Exec(`DELETE FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "unlinked"})
+}
+
+type provisionTx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Commit() error
+	Rollback() error
+}
+
+func (h *AuthHandler) provisionUser(ident oidc.Identity) (string, error) {
+	return provision(ident, func() (provisionTx, error) {
+		return h.DB.Begin()
+	})
+}
+
+func provision(ident oidc.Identity, begin func() (provisionTx, error)) (string, error) {
+	base := usernameBase(ident)
+	userID := uuid.NewString()
+	for attempt := 1; attempt <= maxUsernameAttempts; attempt++ {
+		username := usernameCandidate(base, attempt)
+		tx, err := begin()
+		if err != nil {
+			return "", err
+		}
+		_, err = tx.Exec("INSERT INTO users (user_id, username, password_hash) VALUES (?, ?, '')", userID, username)
+		if isDuplicate(err) {
+			tx.Rollback()
+			continue
+		}
+		if err == nil {
+			_, err = tx.Exec(`
+				INSERT INTO user_identities (user_id, provider, subject, email)
+				VALUES (?, ?, ?, ?)
+			`, userID, ident.Provider, ident.Subject, ident.Email)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+		return userID, nil
+	}
+	return "", errors.New("could not find a free username")
+}
+
+func usernameBase(ident oidc.Identity) string {
+	local := ident.Email
+	if i := strings.IndexByte(local, '@'); i >= 0 {
+		local = local[:i]
+	}
+	for _, candidate := range []string{ident.PreferredUsername, local, ident.Name} {
+		if s := sanitizeUsername(candidate); len(s) >= 3 {
+			return s
+		}
+	}
+	return "user"
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('_')
+		}
+	}
+	out := b.String()
+	if len(out) > 32 {
+		out = out[:32]
+	}
+	return out
+}
+
+func usernameCandidate(base string, attempt int) string {
+	if attempt == 1 {
+		return base
+	}
+	suffix := strconv.Itoa(attempt)
+	if attempt > maxUsernameAttempts/2 {
+		suffix = strings.ReplaceAll(uuid.NewString(), "-", "")[:6]
+	}
+	suffix = "_" + suffix
+	if len(base)+len(suffix) > 32 {
+		base = base[:32-len(suffix)]
+	}
+	return base + suffix
+}
+
+func identityOwner(db *sql.DB, ident oidc.Identity) (string, error) {
+	var userID string
+	err := db.QueryRow(`
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`, ident.Provider, ident.Subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+func consumeOIDCState(db *sql.DB, raw string) (*oidcState, error) {
+	hash := hashState(raw)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var st oidcState
+	err = tx.QueryRow(`
+		SELECT provider, nonce, code_verifier, link_user_id, expires_at
+		FROM oidc_states WHERE state_hash = ?
+		FOR UPDATE
+	`, hash).Scan(&st.provider, &st.nonce, &st.verifier, &st.linkUserID, &st.expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM oidc_states WHERE state_hash = ?`, hash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+func isDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlDuplicateEntry
+}
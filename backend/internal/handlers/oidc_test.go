@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"p2p-chat-app/backend/internal/oidc"
+)
+
+type fakeUsers struct {
+	taken     map[string]bool
+	attempts  []string
+	committed []string
+	rollbacks int
+}
+
+type fakeTx struct {
+	db       *fakeUsers
+	username string
+}
+
+func (tx *fakeTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if strings.Contains(query, "INSERT INTO users") {
+		tx.username = args[1].(string)
+		tx.db.attempts = append(tx.db.attempts, tx.username)
+		if tx.db.taken[tx.username] {
+			return nil, &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry"}
+		}
+	}
+	return nil, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.committed = append(tx.db.committed, tx.username)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.rollbacks++
+	return nil
+}
+
+func (f *fakeUsers) begin() (provisionTx, error) {
+	return &fakeTx{db: f}, nil
+}
+
+func TestProvisionUsernameCollisions(t *testing.T) {
+	ident := oidc.Identity{Provider: "google", Subject: "s1", PreferredUsername: "alice"}
+	db := &fakeUsers{taken: map[string]bool{"alice": true, "alice_2": true}}
+	userID, err := provision(ident, db.begin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID == "" {
+		t.Fatal("empty user id")
+	}
+	if got := strings.Join(db.attempts, ","); got != "alice,alice_2,alice_3" {
+		t.Fatalf("attempts = %s", got)
+	}
+	if len(db.committed) != 1 || db.committed[0] != "alice_3" || db.rollbacks != 2 {
+		t.Fatalf("committed = %v, rollbacks = %d", db.committed, db.rollbacks)
+	}
+}
+
+func TestProvisionGivesUp(t *testing.T) {
+	db := &fakeUsers{taken: map[string]bool{}}
+	tx := &fakeTx{db: db}
+	begin := func() (provisionTx, error) {
+		return &takenTx{tx}, nil
+	}
+	_, err := provision(oidc.Identity{Provider: "google", Subject: "s1", Email: "bob@example.com"}, begin)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(db.attempts) != maxUsernameAttempts || len(db.committed) != 0 {
+		t.Fatalf("attempts = %d, committed = %v", len(db.attempts), db.committed)
+	}
+	seen := map[string]bool{}
+	for _, name := range db.attempts {
+		if seen[name] {
+			t.Fatalf("username %q tried twice", name)
+		}
+		seen[name] = true
+	}
+}
+
+type takenTx struct{ *fakeTx }
+
+func (tx *takenTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	tx.db.taken[args[1].(string)] = true
+	return tx.fakeTx.Exec(query, args...)
+}
+
+func TestProvisionPropagatesErrors(t *testing.T) {
+	boom := errors.New("boom")
+	begin := func() (provisionTx, error) { return nil, boom }
+	if _, err := provision(oidc.Identity{}, begin); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+}
+
+func TestUsernameCandidate(t *testing.T) {
+	long := strings.Repeat("a", 32)
+	cases := []struct {
+		base    string
+		attempt int
+		want    string
+	}{
+		{"alice", 1, "alice"},
+		{"alice", 2, "alice_2"},
+		{"alice", 10, "alice_10"},
+		{long, 3, strings.Repeat("a", 30) + "_3"},
+	}
+	for _, tc := range cases {
+		if got := usernameCandidate(tc.base, tc.attempt); got != tc.want {
+			t.Errorf("usernameCandidate(%q, %d) = %q, want %q", tc.base, tc.attempt, got, tc.want)
+		}
+	}
+	random := usernameCandidate(long, maxUsernameAttempts)
+	if len(random) != 32 || !strings.HasPrefix(random, strings.Repeat("a", 25)+"_") {
+		t.Errorf("random candidate = %q", random)
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	cases := []struct {
+		ident oidc.Identity
+		want  string
+	}{
+		{oidc.Identity{PreferredUsername: "Alice Smith"}, "Alice_Smith"},
+		{oidc.Identity{PreferredUsername: "a!", Email: "bob.jones@example.com"}, "bob.jones"},
+		{oidc.Identity{Email: "x@example.com", Name: "Carol"}, "Carol"},
+		{oidc.Identity{}, "user"},
+	}
+	for _, tc := range cases {
+		if got := usernameBase(tc.ident); got != tc.want {
+			t.Errorf("usernameBase(%+v) = %q, want %q", tc.ident, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/lockout"
+	"p2p-chat-app/backend/internal/notify"
+	"p2p-chat-app/backend/internal/session"
+	"p2p-chat-app/backend/pkg/utils"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required,max=72"`
+	NewPassword     string `json:"newPassword" binding:"required,min=6,max=72"`
+}
+
+type forgotPasswordRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=32"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required,max=128"`
+	NewPassword string `json:"newPassword" binding:"required,min=6,max=72"`
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+
+	var username, passwordHash string
+	err := h.DB.QueryRow("SELECT username, password_hash FROM users WHERE user_id = ?", userID).Scan(&username, &passwordHash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	attempt := lockout.Attempt{
+		Username:  username,
+		UserID:    userID,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if h.throttled(c, attempt) {
+		return
+	}
+	if !utils.CheckPassword(req.CurrentPassword, passwordHash) {
+		h.loginFailed(c, attempt, lockout.OutcomeBadPassword)
+		return
+	}
+	if err := h.Guard.Succeed(attempt); err != nil {
+		log.Printf("login throttle reset error: %v", err)
+	}
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password hashing failed"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE user_id = ?", hash, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := session.RevokeOthers(tx, userID, c.GetString("sessionId")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	h.Sessions.Publish(session.Revocation{UserID: userID, Keep: c.GetString("sessionId")})
+	c.JSON(http.StatusOK, gin.H{"status": "password_changed"})
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	go h.requestReset(req.Username)
+	c.JSON(http.StatusAccepted, gin.H{"status": "reset_requested"})
+}
+
+func (h *AuthHandler) requestReset(username string) {
+	var userID string
+	err := h.DB.QueryRow(`
+		SELECT user_id FROM users
+		WHERE username = ? AND user_id NOT IN (SELECT user_id FROM service_accounts)
+	`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err == nil {
+		err = h.sendReset(userID, username)
+	}
+	if err != nil {
+		log.Printf("password reset error: %v", err)
+	}
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password hashing failed"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE
+	`, hashResetToken(req.Token), time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", time.Now(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE user_id = ?", hash, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := session.RevokeAll(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	h.Sessions.Publish(session.Revocation{UserID: userID})
+	c.JSON(http.StatusOK, gin.H{"status": "password_reset"})
+}
+
+func (h *AuthHandler) sendReset(userID, username string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(h.ResetTTL)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, userID, hashResetToken(token), expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return h.Notifier.SendPasswordReset(notify.PasswordReset{
+		UserID:    userID,
+		Username:  username,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,48 +3,197 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/presence"
 )
 
 type PresenceHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store *presence.Store
 }
 
-type presenceItem struct {
-	UserID string `json:"userId"`
-	Status string `json:"status"`
-	LastSeen *int64 `json:"lastSeen"`
+type presenceUpdateInput struct {
+	Status  string `json:"status" binding:"required"`
+	Message string `json:"message"`
+}
+
+type presencePrivacyInput struct {
+	LastSeen       string   `json:"lastSeen" binding:"required"`
+	HideFromGroups bool     `json:"hideFromGroups"`
+	HiddenFrom     []string `json:"hiddenFrom"`
 }
 
 func (h *PresenceHandler) List(c *gin.Context) {
 	userID := c.GetString("userId")
-	rows, err := h.DB.Query(`
-		SELECT f.friend_user_id, COALESCE(p.status, 'offline'), p.last_seen
-		FROM friends f
-		LEFT JOIN presence p ON p.user_id = f.friend_user_id
-		WHERE f.user_id = ?
-		ORDER BY f.created_at DESC
-	`, userID)
+	groupID := c.Query("groupId")
+	if groupID != "" && !isGroupMember(h.DB, groupID, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not a group member"})
+		return
+	}
+
+	var ids []string
+	var relations map[string]presence.Relation
+	var err error
+	if groupID != "" {
+		ids, relations, err = groupPresenceTargets(h.DB, groupID, userID)
+	} else {
+		ids, relations, err = friendPresenceTargets(h.DB, userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	states, err := h.Store.GetMany(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	privacies, err := h.Store.Privacies(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	items := make([]presence.View, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, privacies[id].Apply(states[id].View(), userID, relations[id]))
+	}
+	c.JSON(http.StatusOK, gin.H{"presence": items})
+}
+
+func (h *PresenceHandler) Update(c *gin.Context) {
+	var req presenceUpdateInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+	var updateErr error
+	state, _, err := h.Store.Update(userID, func(s *presence.State) bool {
+		if updateErr = s.SetPreference(req.Status, req.Message); updateErr != nil {
+			return false
+		}
+		if s.Online() {
+			s.Touch(time.Now())
+		}
+		return true
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if updateErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": updateErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    state.Status,
+		"preferred": state.Preferred,
+		"message":   state.Message,
+	})
+}
+
+func (h *PresenceHandler) Privacy(c *gin.Context) {
+	userID := c.GetString("userId")
+	p, err := h.Store.Privacy(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *PresenceHandler) UpdatePrivacy(c *gin.Context) {
+	var req presencePrivacyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	userID := c.GetString("userId")
+	p := presence.Privacy{
+		LastSeen:       req.LastSeen,
+		HideFromGroups: req.HideFromGroups,
+		HiddenFrom:     dedupeIDs(req.HiddenFrom, userID),
+	}
+	if err := p.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.Store.SetPrivacy(userID, p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func friendPresenceTargets(db *sql.DB, userID string) ([]string, map[string]presence.Relation, error) {
+	rows, err := db.Query(`
+		SELECT friend_user_id
+		FROM friends
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer rows.Close()
+	ids := make([]string, 0)
+	relations := make(map[string]presence.Relation)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		relations[id] = presence.RelationFriend
+	}
+	return ids, relations, rows.Err()
+}
 
-	items := make([]presenceItem, 0)
+func groupPresenceTargets(db *sql.DB, groupID, userID string) ([]string, map[string]presence.Relation, error) {
+	rows, err := db.Query(`
+		SELECT gm.user_id, f.id IS NOT NULL
+		FROM `+"`group_members`"+` gm
+		LEFT JOIN friends f ON f.user_id = ? AND f.friend_user_id = gm.user_id
+		WHERE gm.group_id = ? AND gm.user_id <> ?
+		ORDER BY gm.created_at ASC
+	`, userID, groupID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	relations := make(map[string]presence.Relation)
 	for rows.Next() {
-		var item presenceItem
-		var lastSeen sql.NullTime
-		if err := rows.Scan(&item.UserID, &item.Status, &lastSeen); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-			return
+		var id string
+		var friend bool
+		if err := rows.Scan(&id, &friend); err != nil {
+			return nil, nil, err
 		}
-		if lastSeen.Valid {
-			ts := lastSeen.Time.Unix()
-			item.LastSeen = &ts
+		ids = append(ids, id)
+		relations[id] = presence.RelationGroup
+		if friend {
+			relations[id] = presence.RelationFriend
 		}
-		items = append(items, item)
 	}
-	c.JSON(http.StatusOK, gin.H{"presence": items})
+	return ids, relations, rows.Err()
+}
+
+func dedupeIDs(ids []string, exclude string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || id == exclude {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
 }
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/ratelimit"
+	"p2p-chat-app/backend/internal/session"
+)
+
+const maxServiceAccounts = 10
+
+type ServiceAccountsHandler struct {
+	DB       *sql.DB
+	Sessions *session.Revocations
+}
+
+type serviceAccountRequest struct {
+	Name string `json:"name" binding:"required,min=3,max=32"`
+}
+
+type serviceAccountItem struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type apiKeyRequest struct {
+	Name      string   `json:"name" binding:"required,min=1,max=64"`
+	Scopes    []string `json:"scopes" binding:"required"`
+	RateLimit string   `json:"rateLimit"`
+	ExpiresIn string   `json:"expiresIn"`
+}
+
+type apiKeyResponse struct {
+	Secret string `json:"key"`
+	*apikey.Key
+}
+
+func (h *ServiceAccountsHandler) Create(c *gin.Context) {
+	var req serviceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	ownerID := c.GetString("userId")
+
+	var count int
+	if err := h.DB.QueryRow(`
+		SELECT COUNT(*) FROM service_accounts WHERE owner_user_id = ? AND disabled_at IS NULL
+	`, ownerID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if count >= maxServiceAccounts {
+		c.JSON(http.StatusConflict, gin.H{"error": "service account limit reached"})
+		return
+	}
+
+	userID := uuid.NewString()
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO users (user_id, username, password_hash) VALUES (?, ?, '')", userID, req.Name)
+	if isDuplicate(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO service_accounts (user_id, owner_user_id, name) VALUES (?, ?, ?)
+	`, userID, ownerID, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusCreated, serviceAccountItem{ID: userID, Username: req.Name, CreatedAt: time.Now()})
+}
+
+func (h *ServiceAccountsHandler) List(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT s.user_id, u.username, s.created_at
+		FROM service_accounts s
+		JOIN users u ON u.user_id = s.user_id
+		WHERE s.owner_user_id = ? AND s.disabled_at IS NULL
+		ORDER BY s.created_at
+	`, c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer rows.Close()
+
+	items := []serviceAccountItem{}
+	for rows.Next() {
+		var item serviceAccountItem
+		if err := rows.Scan(&item.ID, &item.Username, &item.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func (h *ServiceAccountsHandler) Delete(c *gin.Context) {
+	accountID, ok := h.owned(c)
+	if !ok {
+		return
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE service_accounts SET disabled_at = ? WHERE user_id = ?`, now, accountID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, accountID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	h.Sessions.Publish(session.Revocation{UserID: accountID})
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+func (h *ServiceAccountsHandler) CreateKey(c *gin.Context) {
+	accountID, ok := h.owned(c)
+	if !ok {
+		return
+	}
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	scopes, err := apikey.NormalizeScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RateLimit != "" {
+		if _, err := ratelimit.ParsePolicy("apikey", req.RateLimit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expiresIn"})
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+	raw, key, err := apikey.Create(h.DB, accountID, req.Name, scopes, req.RateLimit, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusCreated, apiKeyResponse{Secret: raw, Key: key})
+}
+
+func (h *ServiceAccountsHandler) ListKeys(c *gin.Context) {
+	accountID, ok := h.owned(c)
+	if !ok {
+		return
+	}
+	keys, err := apikey.List(h.DB, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *ServiceAccountsHandler) RevokeKey(c *gin.Context) {
+	accountID, ok := h.owned(c)
+	if !ok {
+		return
+	}
+	keyID := c.Param("keyId")
+	revoked, err := apikey.Revoke(h.DB, accountID, keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	h.Sessions.Publish(session.Revocation{UserID: accountID, SessionID: apikey.SessionID(keyID)})
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+func (h *ServiceAccountsHandler) owned(c *gin.Context) (string, bool) {
+	accountID := c.Param("id")
+	var exists int
+	err := h.DB.QueryRow(`
+		SELECT 1 FROM service_accounts
+		WHERE user_id = ? AND owner_user_id = ? AND disabled_at IS NULL
+	`, accountID, c.GetString("userId")).Scan(&exists)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "service account not found"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return "", false
+	}
+	return accountID, true
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/session"
+)
+
+type SessionsHandler struct {
+	DB       *sql.DB
+	Sessions *session.Revocations
+}
+
+func (h *SessionsHandler) List(c *gin.Context) {
+	list, err := session.List(h.DB, c.GetString("userId"), c.GetString("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SessionsHandler) Revoke(c *gin.Context) {
+	userID := c.GetString("userId")
+	sessionID := c.Param("id")
+	ok, err := session.Revoke(h.DB, userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	h.Sessions.Publish(session.Revocation{UserID: userID, SessionID: sessionID})
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
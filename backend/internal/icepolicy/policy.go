@@ -0,0 +1,38 @@
+package icepolicy
+
+import "p2p-chat-app/backend/pkg/sdp"
+
+type Policy struct {
+	HideHost               bool `json:"hideHost"`
+	HideSrflx              bool `json:"hideSrflx"`
+	RelayOnlyForNonFriends bool `json:"relayOnlyForNonFriends"`
+}
+
+func Default() Policy {
+	return Policy{}
+}
+
+func (p Policy) Filter(c sdp.Candidate, relayOnly bool) (sdp.Candidate, bool) {
+	switch c.Type {
+	case "host":
+		if relayOnly || p.HideHost {
+			return c, false
+		}
+	case "srflx", "prflx":
+		if relayOnly || p.HideSrflx {
+			return c, false
+		}
+		if p.HideHost {
+			c.ClearRelated()
+		}
+	case "relay":
+		if relayOnly || p.HideHost || p.HideSrflx {
+			c.ClearRelated()
+		}
+	}
+	return c, true
+}
+
+func (p Policy) RelayOnly(friends bool) bool {
+	return p.RelayOnlyForNonFriends && !friends
+}
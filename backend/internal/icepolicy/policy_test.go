@@ -0,0 +1,71 @@
+package icepolicy
+
+import (
+	"testing"
+
+	"p2p-chat-app/backend/pkg/sdp"
+)
+
+func candidate(t *testing.T, line string) sdp.Candidate {
+	t.Helper()
+	c, err := sdp.ParseCandidate(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFilter(t *testing.T) {
+	host := "candidate:1 1 udp 2122260223 192.168.0.196 46243 typ host"
+	srflx := "candidate:2 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243"
+	prflx := "candidate:3 1 udp 1853824767 203.0.113.8 50000 typ prflx raddr 192.168.0.196 rport 46243"
+	relay := "candidate:4 1 udp 41885439 198.51.100.20 3478 typ relay raddr 203.0.113.7 rport 46243"
+	srflxCleared := "candidate:2 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 0.0.0.0 rport 0"
+	prflxCleared := "candidate:3 1 udp 1853824767 203.0.113.8 50000 typ prflx raddr 0.0.0.0 rport 0"
+	relayCleared := "candidate:4 1 udp 41885439 198.51.100.20 3478 typ relay raddr 0.0.0.0 rport 0"
+
+	cases := []struct {
+		name      string
+		policy    Policy
+		relayOnly bool
+		want      map[string]string
+	}{
+		{"default", Default(), false, map[string]string{host: host, srflx: srflx, prflx: prflx, relay: relay}},
+		{"hide host", Policy{HideHost: true}, false, map[string]string{host: "", srflx: srflxCleared, prflx: prflxCleared, relay: relayCleared}},
+		{"hide srflx", Policy{HideSrflx: true}, false, map[string]string{host: host, srflx: "", prflx: "", relay: relayCleared}},
+		{"hide both", Policy{HideHost: true, HideSrflx: true}, false, map[string]string{host: "", srflx: "", prflx: "", relay: relayCleared}},
+		{"relay only", Policy{RelayOnlyForNonFriends: true}, true, map[string]string{host: "", srflx: "", prflx: "", relay: relayCleared}},
+		{"relay only flag with friend", Policy{RelayOnlyForNonFriends: true}, false, map[string]string{host: host, srflx: srflx, prflx: prflx, relay: relay}},
+	}
+	for _, tc := range cases {
+		for in, want := range tc.want {
+			got, keep := tc.policy.Filter(candidate(t, in), tc.relayOnly)
+			if want == "" {
+				if keep {
+					t.Errorf("%s: %q was kept as %q, want dropped", tc.name, in, got.String())
+				}
+				continue
+			}
+			if !keep {
+				t.Errorf("%s: %q was dropped", tc.name, in)
+				continue
+			}
+			if got.String() != want {
+				t.Errorf("%s: Filter(%q) = %q, want %q", tc.name, in, got.String(), want)
+			}
+		}
+	}
+}
+
+func TestRelayOnly(t *testing.T) {
+	p := Policy{RelayOnlyForNonFriends: true}
+	if !p.RelayOnly(false) {
+		t.Error("non-friends should be relay only")
+	}
+	if p.RelayOnly(true) {
+		t.Error("friends should not be relay only")
+	}
+	if Default().RelayOnly(false) {
+		t.Error("default policy should never be relay only")
+	}
+}
@@ -0,0 +1,118 @@
+package icepolicy
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+const topicPolicy = "ice.policy"
+
+type Store struct {
+	db  *sql.DB
+	bus cluster.Bus
+
+	mu        sync.RWMutex
+	policies  map[string]Policy
+	listeners []func(string, Policy)
+}
+
+func NewStore(db *sql.DB, bus cluster.Bus) *Store {
+	s := &Store{
+		db:       db,
+		bus:      bus,
+		policies: make(map[string]Policy),
+	}
+	bus.Subscribe(topicPolicy, s.applyRemote)
+	return s
+}
+
+func (s *Store) OnChange(fn func(string, Policy)) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, fn)
+	s.mu.Unlock()
+}
+
+func (s *Store) Get(userID string) (Policy, error) {
+	s.mu.RLock()
+	p, ok := s.policies[userID]
+	s.mu.RUnlock()
+	if ok {
+		return p, nil
+	}
+	p, err := load(s.db, userID)
+	if err != nil {
+		return Default(), err
+	}
+	s.mu.Lock()
+	s.policies[userID] = p
+	s.mu.Unlock()
+	return p, nil
+}
+
+func (s *Store) Set(userID string, p Policy) error {
+	_, err := s.db.Exec(`
+		INSERT INTO ice_policies (user_id, hide_host, hide_srflx, relay_only_for_non_friends)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			hide_host = VALUES(hide_host),
+			hide_srflx = VALUES(hide_srflx),
+			relay_only_for_non_friends = VALUES(relay_only_for_non_friends)
+	`, userID, p.HideHost, p.HideSrflx, p.RelayOnlyForNonFriends)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.policies[userID] = p
+	s.mu.Unlock()
+	if err := s.bus.Publish(topicPolicy, userID); err != nil {
+		log.Printf("ice policy publish error: %v", err)
+	}
+	s.notify(userID, p)
+	return nil
+}
+
+func (s *Store) notify(userID string, p Policy) {
+	s.mu.RLock()
+	listeners := s.listeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(userID, p)
+	}
+}
+
+func (s *Store) applyRemote(ev cluster.Event) {
+	var userID string
+	if err := json.Unmarshal(ev.Data, &userID); err != nil {
+		log.Printf("ice policy event decode error: %v", err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.policies, userID)
+	s.mu.Unlock()
+	p, err := s.Get(userID)
+	if err != nil {
+		log.Printf("ice policy load error: %v", err)
+		return
+	}
+	s.notify(userID, p)
+}
+
+func load(db *sql.DB, userID string) (Policy, error) {
+	p := Default()
+	err := db.QueryRow(`
+		SELECT hide_host, hide_srflx, relay_only_for_non_friends
+		FROM ice_policies
+		WHERE user_id = ?
+	`, userID).Scan(&p.HideHost, &p.HideSrflx, &p.RelayOnlyForNonFriends)
+	if err == sql.ErrNoRows {
+		return Default(), nil
+	}
+	if err != nil {
+		return Default(), err
+	}
+	return p, nil
+}
@@ -0,0 +1,187 @@
+package lockout
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	scopeUser = "user"
+	scopeIP   = "ip"
+)
+
+const (
+	OutcomeBadPassword = "bad_password"
+	OutcomeUnknownUser = "unknown_user"
+	OutcomeThrottled   = "throttled"
+	OutcomeBadMFACode  = "bad_mfa_code"
+)
+
+type Config struct {
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+	FailureWindow   time.Duration
+	UserThreshold   int
+	IPThreshold     int
+	LockoutDuration time.Duration
+}
+
+type Attempt struct {
+	Username  string
+	UserID    string
+	ClientIP  string
+	UserAgent string
+}
+
+type Guard struct {
+	db  *sql.DB
+	cfg Config
+}
+
+func NewGuard(db *sql.DB, cfg Config) *Guard {
+	return &Guard{db: db, cfg: cfg}
+}
+
+func (g *Guard) Check(a Attempt) (time.Duration, error) {
+	rows, err := g.db.Query(`
+		SELECT scope, failures, last_failure_at, locked_until
+		FROM login_throttles
+		WHERE (scope = ? AND subject = ?) OR (scope = ? AND subject = ?)
+	`, scopeUser, normalize(a.Username), scopeIP, a.ClientIP)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var wait time.Duration
+	for rows.Next() {
+		var scope string
+		var failures int
+		var lastFailure time.Time
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&scope, &failures, &lastFailure, &lockedUntil); err != nil {
+			return 0, err
+		}
+		if lockedUntil.Valid && lockedUntil.Time.After(now) {
+			wait = maxDuration(wait, lockedUntil.Time.Sub(now))
+			continue
+		}
+		if scope == scopeUser && now.Sub(lastFailure) < g.cfg.FailureWindow {
+			wait = maxDuration(wait, lastFailure.Add(g.backoff(failures)).Sub(now))
+		}
+	}
+	return wait, rows.Err()
+}
+
+func (g *Guard) Fail(a Attempt, outcome string) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	subjects := []struct {
+		scope     string
+		subject   string
+		threshold int
+	}{
+		{scopeUser, normalize(a.Username), g.cfg.UserThreshold},
+		{scopeIP, a.ClientIP, g.cfg.IPThreshold},
+	}
+	for _, s := range subjects {
+		var failures int
+		var lastFailure time.Time
+		err := tx.QueryRow(`
+			SELECT failures, last_failure_at
+			FROM login_throttles
+			WHERE scope = ? AND subject = ?
+			FOR UPDATE
+		`, s.scope, s.subject).Scan(&failures, &lastFailure)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == sql.ErrNoRows || now.Sub(lastFailure) >= g.cfg.FailureWindow {
+			failures = 0
+		}
+		failures++
+		var lockedUntil sql.NullTime
+		if failures >= s.threshold {
+			lockedUntil = sql.NullTime{Time: now.Add(g.cfg.LockoutDuration), Valid: true}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO login_throttles (scope, subject, failures, last_failure_at, locked_until)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				failures = VALUES(failures),
+				last_failure_at = VALUES(last_failure_at),
+				locked_until = VALUES(locked_until)
+		`, s.scope, s.subject, failures, now, lockedUntil)
+		if err != nil {
+			return err
+		}
+	}
+	if err := audit(tx, a, outcome); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (g *Guard) Throttled(a Attempt) error {
+	return audit(g.db, a, OutcomeThrottled)
+}
+
+func (g *Guard) Succeed(a Attempt) error {
+	_, err := g.db.Exec(`
+		DELETE FROM login_throttles
+		WHERE scope = ? AND subject = ?
+	`, scopeUser, normalize(a.Username))
+	return err
+}
+
+func (g *Guard) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := g.cfg.BackoffBase
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= g.cfg.BackoffMax {
+			return g.cfg.BackoffMax
+		}
+	}
+	return delay
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func audit(db execer, a Attempt, outcome string) error {
+	var userID sql.NullString
+	if a.UserID != "" {
+		userID = sql.NullString{String: a.UserID, Valid: true}
+	}
+	userAgent := a.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	_, err := db.Exec(`
+		INSERT INTO login_audit (username, user_id, client_ip, user_agent, outcome)
+		VALUES (?, ?, ?, ?, ?)
+	`, a.Username, userID, a.ClientIP, userAgent, outcome)
+	return err
+}
+
+func normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
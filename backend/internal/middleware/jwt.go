@@ -1,14 +1,17 @@
 package middleware
 
 import (
+	"database/sql"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"p2p-chat-app/backend/pkg/utils"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/session"
+	"p2p-chat-app/backend/internal/tokens"
 )
 
-func JWTAuth(secret string) gin.HandlerFunc {
+func JWTAuth(manager *tokens.Manager, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		parts := strings.Split(auth, " ")
@@ -16,12 +19,37 @@ func JWTAuth(secret string) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid authorization"})
 			return
 		}
-		claims, err := utils.ParseToken(parts[1], secret)
+		if apikey.IsKey(parts[1]) {
+			key, err := apikey.Authenticate(db, parts[1], c.ClientIP())
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+				return
+			}
+			if key == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+				return
+			}
+			c.Set("userId", key.UserID)
+			c.Set("apiKey", key)
+			c.Next()
+			return
+		}
+		claims, err := manager.Parse(parts[1])
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
+		active, err := session.Active(db, claims.SessionID, claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			return
+		}
 		c.Set("userId", claims.UserID)
+		c.Set("sessionId", claims.SessionID)
 		c.Next()
 	}
 }
@@ -1,88 +1,89 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/ratelimit"
 )
 
-type clientLimiter struct {
-	tokens   float64
-	lastSeen time.Time
+type RatePolicies struct {
+	Routes map[string]ratelimit.Policy
+	Read   ratelimit.Policy
+	Write  ratelimit.Policy
+	IP     ratelimit.Policy
 }
 
-type RateLimiter struct {
-	rps       float64
-	burst     float64
-	clients   map[string]*clientLimiter
-	mu        sync.Mutex
-	cleanupCh chan struct{}
-}
-
-func NewRateLimiter(rps float64, burst int) *RateLimiter {
-	rl := &RateLimiter{
-		rps:       rps,
-		burst:     float64(burst),
-		clients:   make(map[string]*clientLimiter),
-		cleanupCh: make(chan struct{}),
+func (p RatePolicies) For(method, path string) ratelimit.Policy {
+	if policy, ok := p.Routes[method+" "+path]; ok {
+		return policy
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return p.Read
 	}
-	go rl.cleanupLoop()
-	return rl
+	return p.Write
 }
 
-func (r *RateLimiter) cleanupLoop() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			r.mu.Lock()
-			for key, cl := range r.clients {
-				if time.Since(cl.lastSeen) > 10*time.Minute {
-					delete(r.clients, key)
-				}
+func RateLimit(limiter ratelimit.Limiter, policies RatePolicies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := policies.For(c.Request.Method, c.FullPath())
+		key := "ip:" + c.ClientIP()
+		if userID := c.GetString("userId"); userID != "" {
+			key = "user:" + userID
+		}
+		if k, ok := c.Get("apiKey"); ok {
+			apiKey := k.(*apikey.Key)
+			key = "apikey:" + apiKey.ID
+			if p, ok := apiKey.Policy(); ok {
+				policy = capPolicy(policy, p)
 			}
-			r.mu.Unlock()
-		case <-r.cleanupCh:
-			return
 		}
+		enforce(c, limiter, key, policy)
 	}
 }
 
-func (r *RateLimiter) allow(key string) bool {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	now := time.Now()
-	cl, ok := r.clients[key]
-	if !ok {
-		r.clients[key] = &clientLimiter{tokens: r.burst - 1, lastSeen: now}
-		return true
+func capPolicy(route, key ratelimit.Policy) ratelimit.Policy {
+	if key.Rate < route.Rate {
+		route.Rate = key.Rate
 	}
-	elapsed := now.Sub(cl.lastSeen).Seconds()
-	cl.tokens = minFloat(r.burst, cl.tokens+elapsed*r.rps)
-	cl.lastSeen = now
-	if cl.tokens < 1 {
-		return false
+	if key.Burst < route.Burst {
+		route.Burst = key.Burst
 	}
-	cl.tokens -= 1
-	return true
+	return route
 }
 
-func (r *RateLimiter) Middleware() gin.HandlerFunc {
+func IPRateLimit(limiter ratelimit.Limiter, policy ratelimit.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !r.allow(c.ClientIP()) {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
-			return
-		}
-		c.Next()
+		enforce(c, limiter, "ip:"+c.ClientIP(), policy)
 	}
 }
 
-func minFloat(a, b float64) float64 {
-	if a < b {
-		return a
+func enforce(c *gin.Context, limiter ratelimit.Limiter, key string, policy ratelimit.Policy) {
+	res, err := limiter.Allow(c.Request.Context(), key, policy)
+	if err != nil {
+		log.Printf("rate limiter error: %v", err)
+		c.Next()
+		return
+	}
+	window := time.Duration(float64(policy.Burst) / policy.Rate * float64(time.Second))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, seconds(window)))
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	if !res.Allowed {
+		c.Header("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		return
 	}
-	return b
+	c.Next()
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
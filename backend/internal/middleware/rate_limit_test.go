@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/ratelimit"
+)
+
+func TestIPRateLimitRunsBeforeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewMemory()
+	authCalls := 0
+	router := gin.New()
+	router.Use(
+		IPRateLimit(limiter, ratelimit.Policy{Name: "ip", Rate: 0.001, Burst: 2}),
+		func(c *gin.Context) {
+			authCalls++
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		},
+	)
+	router.GET("/users/me", func(c *gin.Context) {})
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+		req.RemoteAddr = "203.0.113.5:4000"
+		req.Header.Set("Authorization", "Bearer garbage")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusUnauthorized || codes[1] != http.StatusUnauthorized || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want [401 401 429]", codes)
+	}
+	if authCalls != 2 {
+		t.Errorf("auth ran %d times, want 2", authCalls)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	req.RemoteAddr = "198.51.100.9:4000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("other client got %d, want 401", rec.Code)
+	}
+}
+
+func TestRateLimitKeysByUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewMemory()
+	policies := RatePolicies{
+		Read:  ratelimit.Policy{Name: "read", Rate: 0.001, Burst: 1},
+		Write: ratelimit.Policy{Name: "write", Rate: 0.001, Burst: 1},
+	}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", c.GetHeader("X-User"))
+	}, RateLimit(limiter, policies))
+	router.GET("/friends/list", func(c *gin.Context) {})
+
+	get := func(user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/friends/list", nil)
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := get("alice"); code != http.StatusOK {
+		t.Fatalf("first request = %d", code)
+	}
+	if code := get("alice"); code != http.StatusTooManyRequests {
+		t.Errorf("second request for alice = %d, want 429", code)
+	}
+	if code := get("bob"); code != http.StatusOK {
+		t.Errorf("first request for bob = %d, want 200", code)
+	}
+}
+
+func TestAPIKeyPolicyCannotExceedRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name      string
+		rateLimit string
+		want      []int
+	}{
+		{"looser key is capped", "1000:1000", []int{200, 200, 429}},
+		{"tighter key applies", "0.001:1", []int{200, 429, 429}},
+		{"no key limit", "", []int{200, 200, 429}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policies := RatePolicies{
+				Routes: map[string]ratelimit.Policy{
+					"POST /auth/login": {Name: "auth", Rate: 0.001, Burst: 2},
+				},
+				Write: ratelimit.Policy{Name: "write", Rate: 1000, Burst: 1000},
+			}
+			key := &apikey.Key{ID: "k1", RateLimit: tc.rateLimit}
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("apiKey", key)
+			}, RateLimit(ratelimit.NewMemory(), policies))
+			router.POST("/auth/login", func(c *gin.Context) {})
+
+			codes := make([]int, 0, len(tc.want))
+			for range tc.want {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", nil))
+				codes = append(codes, rec.Code)
+			}
+			for i := range tc.want {
+				if codes[i] != tc.want[i] {
+					t.Fatalf("status codes = %v, want %v", codes, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"p2p-chat-app/backend/internal/apikey"
+)
+
+func RequireScope(routes map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k, ok := c.Get("apiKey")
+		if !ok {
+			c.Next()
+			return
+		}
+		scope, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok || !k.(*apikey.Key).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key lacks required scope"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type PasswordReset struct {
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Notifier interface {
+	SendPasswordReset(msg PasswordReset) error
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordReset(msg PasswordReset) error {
+	log.Printf("password reset for %s: token=%s expires=%s", msg.Username, msg.Token, msg.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *FileNotifier) SendPasswordReset(msg PasswordReset) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(struct {
+		Kind string `json:"kind"`
+		PasswordReset
+	}{Kind: "password_reset", PasswordReset: msg})
+}
+
+func New(kind, path string) Notifier {
+	if kind == "file" {
+		return &FileNotifier{Path: path}
+	}
+	return LogNotifier{}
+}
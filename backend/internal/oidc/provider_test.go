@@ -0,0 +1,317 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "chat-client"
+	testSecret   = "s3cret"
+)
+
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	issuer string
+
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	jwksHits   int
+	challenges map[string]string
+	claims     jwt.MapClaims
+	kid        string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	m := &mockProvider{t: t, keys: map[string]*rsa.PrivateKey{}, challenges: map[string]string{}}
+	m.addKey("k1")
+	m.kid = "k1"
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	m.issuer = m.server.URL
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) addKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.keys[kid] = key
+	m.mu.Unlock()
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(metadata{
+		Issuer:                m.issuer,
+		AuthorizationEndpoint: m.server.URL + "/authorize",
+		TokenEndpoint:         m.server.URL + "/token",
+		JWKSURI:               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jwksHits++
+	var keys []jwk
+	for kid, key := range m.keys {
+		keys = append(keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.t.Errorf("parse form: %v", err)
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	m.mu.Lock()
+	challenge, found := m.challenges[r.PostForm.Get("code")]
+	m.mu.Unlock()
+	if !found || PKCEChallenge(r.PostForm.Get("code_verifier")) != challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(m.claims)})
+}
+
+func (m *mockProvider) authorize(code, challenge string) {
+	m.mu.Lock()
+	m.challenges[code] = challenge
+	m.mu.Unlock()
+}
+
+func (m *mockProvider) validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   m.issuer,
+		"aud":   testClientID,
+		"sub":   "subject-1",
+		"nonce": "n-0",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"email": "alice@example.com",
+	}
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims) string {
+	m.mu.Lock()
+	kid := m.kid
+	key := m.keys[kid]
+	m.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return raw
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       m.issuer,
+		ClientID:     testClientID,
+		ClientSecret: testSecret,
+		RedirectURL:  "http://localhost/callback",
+	}, m.server.Client())
+}
+
+func TestPKCEChallengeRFC7636(t *testing.T) {
+	got := PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("PKCEChallenge = %q, want %q", got, want)
+	}
+}
+
+func TestAuthURL(t *testing.T) {
+	m := newMockProvider(t)
+	raw, err := m.provider().AuthURL(context.Background(), "st", "nc", "ch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/authorize" {
+		t.Errorf("path = %q", u.Path)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "http://localhost/callback",
+		"scope":                 "openid profile email",
+		"state":                 "st",
+		"nonce":                 "nc",
+		"code_challenge":        "ch",
+		"code_challenge_method": "S256",
+	}
+	q := u.Query()
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.authorize("code-1", PKCEChallenge(verifier))
+	m.claims = m.validClaims()
+
+	if _, err := p.Exchange(context.Background(), "code-1", verifier+"x"); err == nil {
+		t.Fatal("exchange with wrong verifier succeeded")
+	}
+	raw, err := p.Exchange(context.Background(), "code-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ident, err := p.Verify(context.Background(), raw, "n-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Provider != "mock" || ident.Subject != "subject-1" || ident.Email != "alice@example.com" {
+		t.Fatalf("identity = %+v", ident)
+	}
+}
+
+func TestExchangeWithoutIDToken(t *testing.T) {
+	m := newMockProvider(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, m.discovery)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"x"}`))
+	})
+	m.server.Config.Handler = mux
+	if _, err := m.provider().Exchange(context.Background(), "c", "v"); !errors.Is(err, ErrNoIDToken) {
+		t.Fatalf("err = %v, want ErrNoIDToken", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	m := newMockProvider(t)
+	cases := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+		nonce  string
+		want   error
+	}{
+		{"nonce", func(c jwt.MapClaims) {}, "other", ErrNonceMismatch},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, "n-0", ErrNonceMismatch},
+		{"issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, "n-0", jwt.ErrTokenInvalidIssuer},
+		{"audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, "n-0", jwt.ErrTokenInvalidAudience},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, "n-0", jwt.ErrTokenExpired},
+		{"no exp", func(c jwt.MapClaims) { delete(c, "exp") }, "n-0", jwt.ErrTokenRequiredClaimMissing},
+		{"multi aud without azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"} }, "n-0", ErrBadAudience},
+		{"multi aud wrong azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other"}
+			c["azp"] = "other"
+		}, "n-0", ErrBadAudience},
+		{"wrong azp", func(c jwt.MapClaims) { c["azp"] = "other" }, "n-0", ErrBadAudience},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, "n-0", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := m.validClaims()
+			tc.mutate(claims)
+			_, err := m.provider().Verify(context.Background(), m.sign(claims), tc.nonce)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsMultiAudienceWithAZP(t *testing.T) {
+	m := newMockProvider(t)
+	claims := m.validClaims()
+	claims["aud"] = []string{testClientID, "other"}
+	claims["azp"] = testClientID
+	if _, err := m.provider().Verify(context.Background(), m.sign(claims), "n-0"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRefetchIsRateLimited(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+	if _, err := p.Verify(ctx, m.sign(m.validClaims()), "n-0"); err != nil {
+		t.Fatal(err)
+	}
+	if m.jwksHits != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", m.jwksHits)
+	}
+
+	m.addKey("k2")
+	m.kid = "k2"
+	rotated := m.sign(m.validClaims())
+	if _, err := p.Verify(ctx, rotated, "n-0"); err == nil {
+		t.Fatal("unknown kid accepted within the refresh interval")
+	}
+	if m.jwksHits != 1 {
+		t.Fatalf("jwks refetched within the refresh interval (%d fetches)", m.jwksHits)
+	}
+
+	p.keys.mu.Lock()
+	p.keys.fetched = p.keys.fetched.Add(-minKeyRefresh - time.Second)
+	p.keys.mu.Unlock()
+	if _, err := p.Verify(ctx, rotated, "n-0"); err != nil {
+		t.Fatal(err)
+	}
+	if m.jwksHits != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", m.jwksHits)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	m.issuer = "https://evil.example"
+	p := NewProvider(Config{Name: "mock", Issuer: m.server.URL, ClientID: testClientID}, m.server.Client())
+	if _, err := p.AuthURL(context.Background(), "s", "n", "c"); !errors.Is(err, ErrIssuerMismatch) {
+		t.Fatalf("err = %v, want ErrIssuerMismatch", err)
+	}
+}
@@ -0,0 +1,110 @@
+package presence
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type Leases struct {
+	db       *sql.DB
+	store    *Store
+	ttl      time.Duration
+	interval time.Duration
+}
+
+func NewLeases(db *sql.DB, store *Store, ttl, interval time.Duration) *Leases {
+	return &Leases{db: db, store: store, ttl: ttl, interval: interval}
+}
+
+func (l *Leases) Start() error {
+	var lastHeartbeat sql.NullTime
+	err := l.db.QueryRow(`SELECT heartbeat_at FROM presence_nodes WHERE node_id = ?`, l.store.Node()).Scan(&lastHeartbeat)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	expired, err := l.store.ExpireNode(l.store.Node(), lastHeartbeat.Time)
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		log.Printf("presence: marked %d users offline from previous run of %s", expired, l.store.Node())
+	}
+	if err := l.heartbeat(); err != nil {
+		return err
+	}
+	go l.loop()
+	return nil
+}
+
+func (l *Leases) loop() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := l.heartbeat(); err != nil {
+			log.Printf("presence heartbeat error: %v", err)
+		}
+		if err := l.reap(); err != nil {
+			log.Printf("presence reaper error: %v", err)
+		}
+	}
+}
+
+func (l *Leases) heartbeat() error {
+	_, err := l.db.Exec(`
+		INSERT INTO presence_nodes (node_id, started_at, heartbeat_at)
+		VALUES (?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE heartbeat_at = NOW()
+	`, l.store.Node())
+	return err
+}
+
+func (l *Leases) reap() error {
+	rows, err := l.db.Query(`
+		SELECT node_id, heartbeat_at
+		FROM presence_nodes
+		WHERE node_id <> ? AND heartbeat_at < NOW() - INTERVAL ? SECOND
+	`, l.store.Node(), int(l.ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+	type staleNode struct {
+		id        string
+		heartbeat time.Time
+	}
+	stale := make([]staleNode, 0)
+	for rows.Next() {
+		var n staleNode
+		if err := rows.Scan(&n.id, &n.heartbeat); err != nil {
+			rows.Close()
+			return err
+		}
+		stale = append(stale, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, n := range stale {
+		res, err := l.db.Exec(`
+			DELETE FROM presence_nodes
+			WHERE node_id = ? AND heartbeat_at < NOW() - INTERVAL ? SECOND
+		`, n.id, int(l.ttl.Seconds()))
+		if err != nil {
+			return err
+		}
+		if claimed, _ := res.RowsAffected(); claimed == 0 {
+			continue
+		}
+		if err := l.store.Flush(); err != nil {
+			return err
+		}
+		expired, err := l.store.ExpireNode(n.id, n.heartbeat)
+		if err != nil {
+			return err
+		}
+		log.Printf("presence: lease of %s expired, marked %d users offline", n.id, expired)
+	}
+	return nil
+}
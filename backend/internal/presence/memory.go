@@ -0,0 +1,371 @@
+package presence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+const (
+	topicState   = "presence.state"
+	topicPrivacy = "presence.privacy"
+
+	cacheTTL = 5 * time.Minute
+
+	maxPublishBatch = 200
+)
+
+type Store struct {
+	db   *sql.DB
+	bus  cluster.Bus
+	node string
+
+	mu        sync.RWMutex
+	states    map[string]State
+	privacies map[string]Privacy
+	dirty     map[string]struct{}
+	touched   map[string]time.Time
+	pending   map[string]State
+	listeners []func(State)
+
+	kick chan struct{}
+}
+
+func NewStore(db *sql.DB, bus cluster.Bus, node string, flushEvery time.Duration) *Store {
+	s := &Store{
+		db:        db,
+		bus:       bus,
+		node:      node,
+		states:    make(map[string]State),
+		privacies: make(map[string]Privacy),
+		dirty:     make(map[string]struct{}),
+		touched:   make(map[string]time.Time),
+		pending:   make(map[string]State),
+		kick:      make(chan struct{}, 1),
+	}
+	bus.Subscribe(topicState, s.applyRemoteState)
+	bus.Subscribe(topicPrivacy, s.applyRemotePrivacy)
+	go s.flushLoop(flushEvery)
+	go s.publishLoop()
+	return s
+}
+
+func (s *Store) Node() string {
+	return s.node
+}
+
+func (s *Store) OnChange(fn func(State)) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, fn)
+	s.mu.Unlock()
+}
+
+func (s *Store) Get(userID string) (State, error) {
+	states, err := s.GetMany([]string{userID})
+	if err != nil {
+		return Offline(userID), err
+	}
+	return states[userID], nil
+}
+
+func (s *Store) GetMany(userIDs []string) (map[string]State, error) {
+	result := make(map[string]State, len(userIDs))
+	missing := make([]string, 0)
+	s.mu.RLock()
+	for _, id := range userIDs {
+		if state, ok := s.states[id]; ok {
+			result[id] = state
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	s.mu.RUnlock()
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	loaded, err := LoadMany(s.db, missing)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	now := time.Now()
+	for id, state := range loaded {
+		if cached, ok := s.states[id]; ok {
+			state = cached
+		} else {
+			s.states[id] = state
+			s.touched[id] = now
+		}
+		result[id] = state
+	}
+	s.mu.Unlock()
+	return result, nil
+}
+
+func (s *Store) Update(userID string, update func(*State) bool) (State, bool, error) {
+	if _, err := s.Get(userID); err != nil {
+		return Offline(userID), false, err
+	}
+	s.mu.Lock()
+	state := s.states[userID]
+	if !update(&state) {
+		s.mu.Unlock()
+		return state, false, nil
+	}
+	state.Node = s.node
+	state.Version = nextVersion(state.Version)
+	s.states[userID] = state
+	s.dirty[userID] = struct{}{}
+	s.touched[userID] = time.Now()
+	s.mu.Unlock()
+
+	s.publish(state)
+	return state, true, nil
+}
+
+func (s *Store) Republish(userID string) error {
+	state, err := s.Get(userID)
+	if err != nil {
+		return err
+	}
+	s.publish(state)
+	return nil
+}
+
+func (s *Store) Privacy(userID string) (Privacy, error) {
+	privacies, err := s.Privacies([]string{userID})
+	if err != nil {
+		return DefaultPrivacy(), err
+	}
+	return privacies[userID], nil
+}
+
+func (s *Store) Privacies(userIDs []string) (map[string]Privacy, error) {
+	result := make(map[string]Privacy, len(userIDs))
+	missing := make([]string, 0)
+	s.mu.RLock()
+	for _, id := range userIDs {
+		if p, ok := s.privacies[id]; ok {
+			result[id] = p
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	s.mu.RUnlock()
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	loaded, err := LoadPrivacies(s.db, missing)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	now := time.Now()
+	for id, p := range loaded {
+		s.privacies[id] = p
+		s.touched[id] = now
+		result[id] = p
+	}
+	s.mu.Unlock()
+	return result, nil
+}
+
+func (s *Store) SetPrivacy(userID string, p Privacy) error {
+	if err := SavePrivacy(s.db, userID, p); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.privacies[userID] = p
+	s.touched[userID] = time.Now()
+	s.mu.Unlock()
+	if err := s.bus.Publish(topicPrivacy, userID); err != nil {
+		log.Printf("presence privacy publish error: %v", err)
+	}
+	return s.Republish(userID)
+}
+
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	batch := make([]State, 0, len(s.dirty))
+	for id := range s.dirty {
+		batch = append(batch, s.states[id])
+	}
+	s.dirty = make(map[string]struct{})
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := SaveMany(s.db, batch); err != nil {
+		s.mu.Lock()
+		for _, state := range batch {
+			s.dirty[state.UserID] = struct{}{}
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) flushLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Flush(); err != nil {
+			log.Printf("presence flush error: %v", err)
+		}
+		s.evict(time.Now())
+	}
+}
+
+func (s *Store) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, touched := range s.touched {
+		if now.Sub(touched) < cacheTTL {
+			continue
+		}
+		if state, ok := s.states[id]; ok && state.Online() {
+			continue
+		}
+		if _, ok := s.dirty[id]; ok {
+			continue
+		}
+		delete(s.states, id)
+		delete(s.privacies, id)
+		delete(s.touched, id)
+	}
+}
+
+func (s *Store) publish(state State) {
+	s.mu.Lock()
+	if queued, ok := s.pending[state.UserID]; !ok || queued.Version <= state.Version {
+		s.pending[state.UserID] = state
+	}
+	s.mu.Unlock()
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+	s.notify(state)
+}
+
+func (s *Store) publishLoop() {
+	for range s.kick {
+		for s.publishPending() {
+		}
+	}
+}
+
+func (s *Store) publishPending() bool {
+	s.mu.Lock()
+	batch := make([]interface{}, 0, len(s.pending))
+	for id, state := range s.pending {
+		if len(batch) == maxPublishBatch {
+			break
+		}
+		batch = append(batch, state)
+		delete(s.pending, id)
+	}
+	more := len(s.pending) > 0
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return false
+	}
+	if err := s.bus.PublishMany(topicState, batch); err != nil {
+		log.Printf("presence publish error: %v", err)
+	}
+	return more
+}
+
+func (s *Store) notify(state State) {
+	s.mu.RLock()
+	listeners := s.listeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(state)
+	}
+}
+
+func (s *Store) applyRemoteState(ev cluster.Event) {
+	var state State
+	if err := json.Unmarshal(ev.Data, &state); err != nil {
+		log.Printf("presence event decode error: %v", err)
+		return
+	}
+	s.mu.Lock()
+	if cached, ok := s.states[state.UserID]; ok && cached.Version > state.Version {
+		s.mu.Unlock()
+		return
+	}
+	s.states[state.UserID] = state
+	delete(s.dirty, state.UserID)
+	s.touched[state.UserID] = time.Now()
+	s.mu.Unlock()
+	s.notify(state)
+}
+
+func (s *Store) applyRemotePrivacy(ev cluster.Event) {
+	var userID string
+	if err := json.Unmarshal(ev.Data, &userID); err != nil {
+		log.Printf("presence event decode error: %v", err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.privacies, userID)
+	s.mu.Unlock()
+}
+
+func (s *Store) ExpireNode(node string, lastSeen time.Time) (int, error) {
+	ids, err := OwnedBy(s.db, node)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	for id, state := range s.states {
+		if state.Node == node && state.Online() {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	expired := 0
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		_, changed, err := s.Update(id, func(state *State) bool {
+			if state.Node != node || !state.Online() {
+				return false
+			}
+			state.Disconnect()
+			if !lastSeen.IsZero() {
+				state.Touch(lastSeen)
+			}
+			return true
+		})
+		if err != nil {
+			return expired, err
+		}
+		if changed {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func nextVersion(prev int64) int64 {
+	now := time.Now().UnixNano()
+	if now <= prev {
+		return prev + 1
+	}
+	return now
+}
@@ -0,0 +1,130 @@
+package presence
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+type recordingBus struct {
+	mu      sync.Mutex
+	block   chan struct{}
+	batches [][]interface{}
+}
+
+func (b *recordingBus) Publish(topic string, data interface{}) error {
+	return b.PublishMany(topic, []interface{}{data})
+}
+
+func (b *recordingBus) PublishMany(topic string, data []interface{}) error {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mu.Lock()
+	b.batches = append(b.batches, data)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *recordingBus) Subscribe(string, func(cluster.Event)) {}
+
+func (b *recordingBus) published() [][]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([][]interface{}(nil), b.batches...)
+}
+
+func testStore(bus cluster.Bus, users ...string) *Store {
+	s := &Store{
+		bus:       bus,
+		node:      "n1",
+		states:    make(map[string]State),
+		privacies: make(map[string]Privacy),
+		dirty:     make(map[string]struct{}),
+		touched:   make(map[string]time.Time),
+		pending:   make(map[string]State),
+		kick:      make(chan struct{}, 1),
+	}
+	for _, id := range users {
+		s.states[id] = Offline(id)
+	}
+	return s
+}
+
+func TestUpdateDoesNotWaitForBus(t *testing.T) {
+	bus := &recordingBus{block: make(chan struct{})}
+	s := testStore(bus, "alice", "bob")
+	go s.publishLoop()
+	notified := 0
+	s.OnChange(func(State) { notified++ })
+
+	done := make(chan struct{})
+	go func() {
+		for _, id := range []string{"alice", "bob", "alice"} {
+			if _, _, err := s.Update(id, func(st *State) bool {
+				st.Connect()
+				return true
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Update blocked on a stalled bus")
+	}
+	if notified != 3 {
+		t.Errorf("local listeners notified %d times, want 3", notified)
+	}
+	close(bus.block)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		latest := make(map[string]int64)
+		for _, batch := range bus.published() {
+			for _, d := range batch {
+				st := d.(State)
+				latest[st.UserID] = st.Version
+			}
+		}
+		if latest["alice"] == s.states["alice"].Version && latest["bob"] == s.states["bob"].Version {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("published %v, want the latest state of every user", latest)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPublishCoalescesPerUser(t *testing.T) {
+	bus := &recordingBus{}
+	s := testStore(bus)
+	s.publish(State{UserID: "alice", Version: 1})
+	s.publish(State{UserID: "alice", Version: 2})
+	s.publish(State{UserID: "bob", Version: 1})
+	if s.publishPending() {
+		t.Error("publishPending reported leftovers")
+	}
+	batches := bus.published()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("batches = %v, want one batch of two states", batches)
+	}
+}
+
+func TestPublishKeepsNewestVersion(t *testing.T) {
+	s := testStore(&recordingBus{})
+	s.mu.Lock()
+	s.pending["alice"] = State{UserID: "alice", Version: 5}
+	s.mu.Unlock()
+	s.publish(State{UserID: "alice", Version: 3})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st := s.pending["alice"]; st.Version != 5 {
+		t.Errorf("pending version = %d, want 5", st.Version)
+	}
+}
@@ -0,0 +1,126 @@
+package presence
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	StatusOnline    = "online"
+	StatusAway      = "away"
+	StatusBusy      = "busy"
+	StatusDND       = "dnd"
+	StatusInvisible = "invisible"
+	StatusOffline   = "offline"
+)
+
+const MaxMessageLength = 140
+
+var (
+	ErrInvalidStatus  = errors.New("invalid presence status")
+	ErrMessageTooLong = errors.New("status message too long")
+)
+
+type State struct {
+	UserID    string    `json:"userId"`
+	Status    string    `json:"status"`
+	Preferred string    `json:"preferred"`
+	Message   string    `json:"message"`
+	Idle      bool      `json:"idle"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Node      string    `json:"node,omitempty"`
+	Version   int64     `json:"version"`
+}
+
+type View struct {
+	UserID   string `json:"userId"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+	Idle     bool   `json:"idle,omitempty"`
+	LastSeen *int64 `json:"lastSeen"`
+}
+
+func Offline(userID string) State {
+	return State{UserID: userID, Status: StatusOffline, Preferred: StatusOnline}
+}
+
+func ValidPreference(status string) bool {
+	switch status {
+	case StatusOnline, StatusAway, StatusBusy, StatusDND, StatusInvisible:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *State) Online() bool {
+	return s.Status != StatusOffline
+}
+
+func (s *State) Connect() {
+	s.Idle = false
+	s.Status = s.effective()
+}
+
+func (s *State) Disconnect() {
+	s.Idle = false
+	s.Status = StatusOffline
+}
+
+func (s *State) SetIdle(idle bool) bool {
+	if !s.Online() || s.Idle == idle {
+		return false
+	}
+	s.Idle = idle
+	s.Status = s.effective()
+	return true
+}
+
+func (s *State) SetPreference(status, message string) error {
+	if !ValidPreference(status) {
+		return ErrInvalidStatus
+	}
+	if utf8.RuneCountInString(message) > MaxMessageLength {
+		return ErrMessageTooLong
+	}
+	s.Preferred = status
+	s.Message = message
+	if s.Online() {
+		s.Status = s.effective()
+	}
+	return nil
+}
+
+func (s *State) Touch(now time.Time) {
+	if s.Preferred != StatusInvisible {
+		s.LastSeen = now
+	}
+}
+
+func (s *State) effective() string {
+	switch {
+	case s.Preferred == StatusInvisible:
+		return StatusInvisible
+	case s.Idle && (s.Preferred == StatusOnline || s.Preferred == ""):
+		return StatusAway
+	case s.Preferred == "":
+		return StatusOnline
+	default:
+		return s.Preferred
+	}
+}
+
+func (s State) View() View {
+	view := View{UserID: s.UserID, Status: s.Status, Message: s.Message, Idle: s.Idle}
+	if s.Status == StatusInvisible || s.Status == StatusOffline {
+		view.Status = StatusOffline
+		view.Message = ""
+		view.Idle = false
+	}
+	if !s.LastSeen.IsZero() {
+		ts := s.LastSeen.Unix()
+		view.LastSeen = &ts
+	}
+	return view
+}
@@ -0,0 +1,79 @@
+package presence
+
+import "errors"
+
+const (
+	VisibilityEveryone = "everyone"
+	VisibilityFriends  = "friends"
+	VisibilityNobody   = "nobody"
+)
+
+const MaxHiddenFrom = 500
+
+type Relation int
+
+const (
+	RelationOther Relation = iota
+	RelationGroup
+	RelationFriend
+)
+
+var (
+	ErrInvalidVisibility = errors.New("invalid last seen visibility")
+	ErrTooManyHidden     = errors.New("too many hidden users")
+)
+
+type Privacy struct {
+	LastSeen       string   `json:"lastSeen"`
+	HideFromGroups bool     `json:"hideFromGroups"`
+	HiddenFrom     []string `json:"hiddenFrom"`
+}
+
+func DefaultPrivacy() Privacy {
+	return Privacy{LastSeen: VisibilityEveryone, HiddenFrom: make([]string, 0)}
+}
+
+func (p Privacy) Validate() error {
+	switch p.LastSeen {
+	case VisibilityEveryone, VisibilityFriends, VisibilityNobody:
+	default:
+		return ErrInvalidVisibility
+	}
+	if len(p.HiddenFrom) > MaxHiddenFrom {
+		return ErrTooManyHidden
+	}
+	return nil
+}
+
+func (p Privacy) Apply(view View, viewerID string, rel Relation) View {
+	concealed := p.isHiddenFrom(viewerID) || (rel == RelationGroup && p.HideFromGroups)
+	if concealed || rel == RelationOther {
+		view.Status = StatusOffline
+		view.Message = ""
+		view.Idle = false
+	}
+	if concealed || !p.lastSeenVisible(rel) {
+		view.LastSeen = nil
+	}
+	return view
+}
+
+func (p Privacy) isHiddenFrom(viewerID string) bool {
+	for _, id := range p.HiddenFrom {
+		if id == viewerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Privacy) lastSeenVisible(rel Relation) bool {
+	switch p.LastSeen {
+	case VisibilityNobody:
+		return false
+	case VisibilityFriends:
+		return rel == RelationFriend
+	default:
+		return true
+	}
+}
@@ -0,0 +1,192 @@
+package presence
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const saveBatchSize = 500
+
+func SaveMany(db *sql.DB, states []State) error {
+	if len(states) == 0 {
+		return nil
+	}
+	if len(states) > saveBatchSize {
+		if err := SaveMany(db, states[:saveBatchSize]); err != nil {
+			return err
+		}
+		return SaveMany(db, states[saveBatchSize:])
+	}
+	args := make([]interface{}, 0, len(states)*7)
+	for _, state := range states {
+		var lastSeen interface{}
+		if !state.LastSeen.IsZero() {
+			lastSeen = state.LastSeen.UTC().Truncate(time.Second)
+		}
+		var node interface{}
+		if state.Node != "" {
+			node = state.Node
+		}
+		args = append(args, state.UserID, state.Status, state.Preferred, state.Message, state.Idle, node, lastSeen)
+	}
+	values := strings.Repeat("(?, ?, ?, ?, ?, ?, ?),", len(states))
+	_, err := db.Exec(`
+		INSERT INTO presence (user_id, status, preferred_status, custom_message, idle, node_id, last_seen)
+		VALUES `+strings.TrimSuffix(values, ",")+`
+		ON DUPLICATE KEY UPDATE
+			status = VALUES(status),
+			preferred_status = VALUES(preferred_status),
+			custom_message = VALUES(custom_message),
+			idle = VALUES(idle),
+			node_id = VALUES(node_id),
+			last_seen = VALUES(last_seen)
+	`, args...)
+	return err
+}
+
+func LoadMany(db *sql.DB, userIDs []string) (map[string]State, error) {
+	states := make(map[string]State, len(userIDs))
+	for _, id := range userIDs {
+		states[id] = Offline(id)
+	}
+	if len(userIDs) == 0 {
+		return states, nil
+	}
+	rows, err := db.Query(`
+		SELECT user_id, status, preferred_status, custom_message, idle, COALESCE(node_id, ''), last_seen
+		FROM presence
+		WHERE user_id IN (`+placeholders(len(userIDs))+`)
+	`, stringArgs(userIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state State
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&state.UserID, &state.Status, &state.Preferred, &state.Message, &state.Idle, &state.Node, &lastSeen); err != nil {
+			return nil, err
+		}
+		if lastSeen.Valid {
+			state.LastSeen = lastSeen.Time
+		}
+		states[state.UserID] = state
+	}
+	return states, rows.Err()
+}
+
+func LoadPrivacies(db *sql.DB, userIDs []string) (map[string]Privacy, error) {
+	privacies := make(map[string]Privacy, len(userIDs))
+	for _, id := range userIDs {
+		privacies[id] = DefaultPrivacy()
+	}
+	if len(userIDs) == 0 {
+		return privacies, nil
+	}
+	args := stringArgs(userIDs)
+
+	rows, err := db.Query(`
+		SELECT user_id, last_seen_visibility, hide_from_groups
+		FROM presence_privacy
+		WHERE user_id IN (`+placeholders(len(userIDs))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		p := DefaultPrivacy()
+		if err := rows.Scan(&userID, &p.LastSeen, &p.HideFromGroups); err != nil {
+			return nil, err
+		}
+		privacies[userID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hiddenRows, err := db.Query(`
+		SELECT user_id, hidden_from_user_id
+		FROM presence_hidden_from
+		WHERE user_id IN (`+placeholders(len(userIDs))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer hiddenRows.Close()
+	for hiddenRows.Next() {
+		var userID, hiddenFrom string
+		if err := hiddenRows.Scan(&userID, &hiddenFrom); err != nil {
+			return nil, err
+		}
+		p := privacies[userID]
+		p.HiddenFrom = append(p.HiddenFrom, hiddenFrom)
+		privacies[userID] = p
+	}
+	return privacies, hiddenRows.Err()
+}
+
+func SavePrivacy(db *sql.DB, userID string, p Privacy) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO presence_privacy (user_id, last_seen_visibility, hide_from_groups)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			last_seen_visibility = VALUES(last_seen_visibility),
+			hide_from_groups = VALUES(hide_from_groups)
+	`, userID, p.LastSeen, p.HideFromGroups)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM presence_hidden_from WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hiddenFrom := range p.HiddenFrom {
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO presence_hidden_from (user_id, hidden_from_user_id) VALUES (?, ?)
+		`, userID, hiddenFrom)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+func OwnedBy(db *sql.DB, node string) ([]string, error) {
+	rows, err := db.Query(`SELECT user_id FROM presence WHERE node_id = ? AND status <> 'offline'`, node)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const fallbackLogEvery = time.Minute
+
+type Fallback struct {
+	primary   Limiter
+	secondary Limiter
+	lastLog   atomic.Int64
+}
+
+func NewFallback(primary, secondary Limiter) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary}
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	res, err := f.primary.Allow(ctx, key, policy)
+	if err == nil {
+		return res, nil
+	}
+	now := time.Now().UnixNano()
+	if last := f.lastLog.Load(); now-last >= int64(fallbackLogEvery) && f.lastLog.CompareAndSwap(last, now) {
+		log.Printf("rate limiter error, using local limits: %v", err)
+	}
+	return f.secondary.Allow(ctx, key, policy)
+}
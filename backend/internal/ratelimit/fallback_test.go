@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+type failingLimiter struct{ calls int }
+
+func (f *failingLimiter) Allow(context.Context, string, Policy) (Result, error) {
+	f.calls++
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackKeepsLimitingWhenPrimaryFails(t *testing.T) {
+	primary := &failingLimiter{}
+	limiter := NewFallback(primary, NewMemory())
+	policy := Policy{Name: "auth", Rate: 0.001, Burst: 2}
+	var allowed []bool
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(context.Background(), "ip:1", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed = append(allowed, res.Allowed)
+	}
+	if !allowed[0] || !allowed[1] || allowed[2] {
+		t.Errorf("allowed = %v, want [true true false]", allowed)
+	}
+	if primary.calls != 3 {
+		t.Errorf("primary called %d times, want 3", primary.calls)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, p := range []Policy{
+		{Name: "zero rate", Rate: 0, Burst: 1},
+		{Name: "negative rate", Rate: -1, Burst: 1},
+		{Name: "nan rate", Rate: math.NaN(), Burst: 1},
+		{Name: "inf rate", Rate: math.Inf(1), Burst: 1},
+		{Name: "zero burst", Rate: 1, Burst: 0},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: Validate succeeded", p.Name)
+		}
+	}
+	if err := (Policy{Name: "ok", Rate: 0.1, Burst: 5}).Validate(); err != nil {
+		t.Errorf("valid policy rejected: %v", err)
+	}
+	for _, spec := range []string{"0:5", "1:0", "x:5", "1", "NaN:5"} {
+		if _, err := ParsePolicy("p", spec); err == nil {
+			t.Errorf("ParsePolicy(%q) succeeded", spec)
+		}
+	}
+}
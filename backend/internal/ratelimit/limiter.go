@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+func ParsePolicy(name, spec string) (Policy, error) {
+	rate, burst, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q for %s", spec, name)
+	}
+	r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid rate %q for %s", rate, name)
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid burst %q for %s", burst, name)
+	}
+	p := Policy{Name: name, Rate: r, Burst: b}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+func (p Policy) Validate() error {
+	if !(p.Rate > 0) || math.IsInf(p.Rate, 0) {
+		return fmt.Errorf("invalid rate %v for %s", p.Rate, p.Name)
+	}
+	if p.Burst < 1 {
+		return fmt.Errorf("invalid burst %d for %s", p.Burst, p.Name)
+	}
+	return nil
+}
+
+func (p Policy) ttl() time.Duration {
+	return time.Duration(float64(p.Burst)/p.Rate*float64(time.Second)) + time.Second
+}
+
+func refill(p Policy, tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(p.Burst), tokens+elapsed.Seconds()*p.Rate)
+}
+
+func resultFor(p Policy, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     p.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(p.Burst) - tokens) / p.Rate * float64(time.Second)),
+	}
+	if r.Remaining < 0 {
+		r.Remaining = 0
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration((1 - tokens) / p.Rate * float64(time.Second))
+	}
+	return r
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+	ttl      time.Duration
+}
+
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemory() *Memory {
+	m := &Memory{buckets: make(map[string]*bucket)}
+	go m.cleanupLoop()
+	return m
+}
+
+func (m *Memory) Allow(_ context.Context, key string, policy Policy) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	key = policy.Name + ":" + key
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), lastSeen: now, ttl: policy.ttl()}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(policy, b.tokens, now.Sub(b.lastSeen))
+	b.lastSeen = now
+	if b.tokens < 1 {
+		return resultFor(policy, b.tokens, false), nil
+	}
+	b.tokens--
+	return resultFor(policy, b.tokens, true), nil
+}
+
+func (m *Memory) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mu.Lock()
+		for key, b := range m.buckets {
+			if time.Since(b.lastSeen) > b.ttl {
+				delete(m.buckets, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tokenBucketScript = `
+local data = redis.call('HMGET', KEYS[1], 't', 'ts')
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`
+
+var tokenBucketSHA = scriptSHA(tokenBucketScript)
+
+var errUnexpectedReply = errors.New("redis: unexpected reply")
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+type Redis struct {
+	addr     string
+	password string
+	prefix   string
+	timeout  time.Duration
+	idle     chan *redisConn
+	now      func() time.Time
+}
+
+func NewRedis(addr, password string, poolSize int) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		prefix:   "ratelimit:",
+		timeout:  time.Second,
+		idle:     make(chan *redisConn, poolSize),
+		now:      time.Now,
+	}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	args := []string{"1",
+		r.prefix + policy.Name + ":" + key,
+		strconv.FormatFloat(policy.Rate, 'f', -1, 64),
+		strconv.Itoa(policy.Burst),
+		strconv.FormatInt(r.now().UnixMilli(), 10),
+		strconv.FormatInt(policy.ttl().Milliseconds(), 10),
+	}
+	reply, err := r.do(ctx, append([]string{"EVALSHA", tokenBucketSHA}, args...)...)
+	if isNoScript(err) {
+		reply, err = r.do(ctx, append([]string{"EVAL", tokenBucketScript}, args...)...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, errUnexpectedReply
+	}
+	allowed, ok := values[0].(int64)
+	if !ok {
+		return Result{}, errUnexpectedReply
+	}
+	raw, ok := values[1].(string)
+	if !ok {
+		return Result{}, errUnexpectedReply
+	}
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, errUnexpectedReply
+	}
+	return resultFor(policy, tokens, allowed == 1), nil
+}
+
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := r.roundTrip(ctx, c, args)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			_ = c.conn.Close()
+			return nil, err
+		}
+	}
+	r.put(c)
+	return reply, err
+}
+
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: r.timeout}
+	conn, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+	if r.password == "" {
+		return c, nil
+	}
+	if _, err := r.roundTrip(ctx, c, []string{"AUTH", r.password}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	select {
+	case r.idle <- c:
+	default:
+		_ = c.conn.Close()
+	}
+}
+
+func (r *Redis) roundTrip(ctx context.Context, c *redisConn, args []string) (interface{}, error) {
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n", len(arg))...)
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errUnexpectedReply
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errUnexpectedReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errUnexpectedReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := readReply(rd)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, errUnexpectedReply
+}
+
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+func isNoScript(err error) bool {
+	e, ok := err.(redisError)
+	return ok && strings.HasPrefix(string(e), "NOSCRIPT")
+}
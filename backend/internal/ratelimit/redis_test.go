@@ -0,0 +1,411 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks enough RESP to serve the limiter: AUTH, EVAL and EVALSHA
+// of the token bucket script, which it emulates in Go.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	scripts map[string]string
+	hashes  map[string]map[string]string
+	expiry  map[string]int64
+	calls   map[string]int
+	conns   int
+	inject  []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:       ln,
+		password: password,
+		scripts:  make(map[string]string),
+		hashes:   make(map[string]map[string]string),
+		expiry:   make(map[string]int64),
+		calls:    make(map[string]int),
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns++
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		req, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		items, ok := req.([]interface{})
+		if !ok || len(items) == 0 {
+			fmt.Fprint(conn, "-ERR protocol error\r\n")
+			continue
+		}
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		cmd := strings.ToUpper(args[0])
+
+		f.mu.Lock()
+		f.calls[cmd]++
+		var injected string
+		if len(f.inject) > 0 && cmd != "AUTH" {
+			injected, f.inject = f.inject[0], f.inject[1:]
+		}
+		f.mu.Unlock()
+
+		switch {
+		case injected == "close":
+			return
+		case injected != "":
+			fmt.Fprintf(conn, "-%s\r\n", injected)
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid username-password pair\r\n")
+			}
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case cmd == "EVAL" && len(args) >= 3:
+			f.mu.Lock()
+			f.scripts[scriptSHA(args[1])] = args[1]
+			f.mu.Unlock()
+			fmt.Fprint(conn, f.run(args[1], args[2:]))
+		case cmd == "EVALSHA" && len(args) >= 3:
+			f.mu.Lock()
+			script, ok := f.scripts[strings.ToLower(args[1])]
+			f.mu.Unlock()
+			if !ok {
+				fmt.Fprint(conn, "-NOSCRIPT No matching script. Please use EVAL.\r\n")
+				continue
+			}
+			fmt.Fprint(conn, f.run(script, args[2:]))
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func (f *fakeRedis) run(script string, args []string) string {
+	if script != tokenBucketScript {
+		return "-ERR unknown script\r\n"
+	}
+	if len(args) != 6 || args[0] != "1" {
+		return "-ERR wrong number of arguments\r\n"
+	}
+	key := args[1]
+	rate, _ := strconv.ParseFloat(args[2], 64)
+	burst, _ := strconv.ParseFloat(args[3], 64)
+	now, _ := strconv.ParseFloat(args[4], 64)
+	ttl, _ := strconv.ParseInt(args[5], 10, 64)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := f.hashes[key]
+	tokens, errT := strconv.ParseFloat(data["t"], 64)
+	ts, errTS := strconv.ParseFloat(data["ts"], 64)
+	if data == nil || errT != nil || errTS != nil {
+		tokens, ts = burst, now
+	}
+	tokens = math.Min(burst, tokens+math.Max(0, now-ts)/1000*rate)
+	allowed := 0
+	if tokens >= 1 {
+		tokens--
+		allowed = 1
+	}
+	remaining := strconv.FormatFloat(tokens, 'g', 14, 64)
+	f.hashes[key] = map[string]string{"t": remaining, "ts": args[4]}
+	f.expiry[key] = ttl
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(remaining), remaining)
+}
+
+func (f *fakeRedis) count(cmd string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[cmd]
+}
+
+func (f *fakeRedis) injectReplies(replies ...string) {
+	f.mu.Lock()
+	f.inject = append(f.inject, replies...)
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) flushScripts() {
+	f.mu.Lock()
+	f.scripts = make(map[string]string)
+	f.mu.Unlock()
+}
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestRedis(f *fakeRedis, password string) (*Redis, *fakeClock) {
+	clock := &fakeClock{t: time.UnixMilli(1700000000000)}
+	r := NewRedis(f.addr(), password, 2)
+	r.now = clock.now
+	return r, clock
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, clock := newTestRedis(f, "")
+	policy := Policy{Name: "login", Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	steps := []struct {
+		advance    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, time.Second},
+		{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+		{500 * time.Millisecond, true, 0, 0},
+		{5 * time.Second, true, 1, 0},
+	}
+	for i, step := range steps {
+		clock.t = clock.t.Add(step.advance)
+		res, err := r.Allow(ctx, "ip:10.0.0.1", policy)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if res.Allowed != step.allowed || res.Remaining != step.remaining || res.RetryAfter != step.retryAfter || res.Limit != 2 {
+			t.Errorf("step %d: got %+v, want allowed=%v remaining=%d retryAfter=%v", i, res, step.allowed, step.remaining, step.retryAfter)
+		}
+	}
+
+	if got := f.count("EVAL"); got != 1 {
+		t.Errorf("EVAL sent %d times, want 1", got)
+	}
+	if got := f.count("EVALSHA"); got != len(steps) {
+		t.Errorf("EVALSHA sent %d times, want %d", got, len(steps))
+	}
+	f.mu.Lock()
+	ttl, ok := f.expiry["ratelimit:login:ip:10.0.0.1"]
+	f.mu.Unlock()
+	if !ok || ttl != policy.ttl().Milliseconds() {
+		t.Errorf("expiry = %d (set %v), want %d", ttl, ok, policy.ttl().Milliseconds())
+	}
+}
+
+func TestRedisKeysArePerPolicyAndKey(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, _ := newTestRedis(f, "")
+	ctx := context.Background()
+	tight := Policy{Name: "a", Rate: 1, Burst: 1}
+	for _, call := range []struct {
+		policy Policy
+		key    string
+	}{
+		{tight, "user:1"},
+		{tight, "user:2"},
+		{Policy{Name: "b", Rate: 1, Burst: 1}, "user:1"},
+	} {
+		res, err := r.Allow(ctx, call.key, call.policy)
+		if err != nil || !res.Allowed {
+			t.Errorf("Allow(%s, %s) = %+v, %v; want allowed", call.policy.Name, call.key, res, err)
+		}
+	}
+	if res, _ := r.Allow(ctx, "user:1", tight); res.Allowed {
+		t.Error("second request on an exhausted bucket was allowed")
+	}
+}
+
+func TestRedisReloadsFlushedScript(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, _ := newTestRedis(f, "")
+	policy := Policy{Name: "p", Rate: 10, Burst: 10}
+	if _, err := r.Allow(context.Background(), "k", policy); err != nil {
+		t.Fatal(err)
+	}
+	f.flushScripts()
+	res, err := r.Allow(context.Background(), "k", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 8 {
+		t.Errorf("after script flush got %+v, want allowed with 8 remaining", res)
+	}
+	if got := f.count("EVAL"); got != 2 {
+		t.Errorf("EVAL sent %d times, want 2", got)
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	policy := Policy{Name: "p", Rate: 1, Burst: 1}
+
+	r, _ := newTestRedis(f, "s3cret")
+	if res, err := r.Allow(context.Background(), "k", policy); err != nil || !res.Allowed {
+		t.Fatalf("Allow with password = %+v, %v", res, err)
+	}
+
+	wrong, _ := newTestRedis(f, "nope")
+	_, err := wrong.Allow(context.Background(), "k", policy)
+	if err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Allow with wrong password error = %v, want WRONGPASS", err)
+	}
+
+	none, _ := newTestRedis(f, "")
+	_, err = none.Allow(context.Background(), "k", policy)
+	if err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("Allow without password error = %v, want NOAUTH", err)
+	}
+}
+
+func TestRedisErrorReplyKeepsConnection(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, _ := newTestRedis(f, "")
+	policy := Policy{Name: "p", Rate: 1, Burst: 5}
+	f.injectReplies("ERR busy")
+	if _, err := r.Allow(context.Background(), "k", policy); err == nil || err.Error() != "redis: ERR busy" {
+		t.Fatalf("error = %v, want redis: ERR busy", err)
+	}
+	if _, err := r.Allow(context.Background(), "k", policy); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	conns := f.conns
+	f.mu.Unlock()
+	if conns != 1 {
+		t.Errorf("opened %d connections, want 1", conns)
+	}
+}
+
+func TestRedisBrokenConnectionIsDiscarded(t *testing.T) {
+	f := newFakeRedis(t, "")
+	r, _ := newTestRedis(f, "")
+	policy := Policy{Name: "p", Rate: 1, Burst: 5}
+	if _, err := r.Allow(context.Background(), "k", policy); err != nil {
+		t.Fatal(err)
+	}
+	f.injectReplies("close")
+	if _, err := r.Allow(context.Background(), "k", policy); err == nil {
+		t.Fatal("expected an error when the server drops the connection")
+	}
+	if _, err := r.Allow(context.Background(), "k", policy); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	conns := f.conns
+	f.mu.Unlock()
+	if conns != 2 {
+		t.Errorf("opened %d connections, want 2", conns)
+	}
+}
+
+func TestRedisDialFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	r := NewRedis(addr, "", 1)
+	if _, err := r.Allow(context.Background(), "k", Policy{Name: "p", Rate: 1, Burst: 1}); err == nil {
+		t.Error("expected a dial error")
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want interface{}
+		err  bool
+	}{
+		{"+OK\r\n", "OK", false},
+		{":42\r\n", int64(42), false},
+		{":-7\r\n", int64(-7), false},
+		{"$5\r\nhello\r\n", "hello", false},
+		{"$0\r\n\r\n", "", false},
+		{"$-1\r\n", nil, false},
+		{"$6\r\na\r\nb\nc\r\n", "a\r\nb\nc", false},
+		{"*-1\r\n", nil, false},
+		{"*0\r\n", []interface{}{}, false},
+		{"*3\r\n:1\r\n$3\r\nabc\r\n*1\r\n+x\r\n", []interface{}{int64(1), "abc", []interface{}{"x"}}, false},
+		{"-ERR bad\r\n", nil, true},
+		{"!3\r\nbad\r\n", nil, true},
+		{"+OK\n", nil, true},
+		{":abc\r\n", nil, true},
+		{"$x\r\n", nil, true},
+		{"$5\r\nhi\r\n", nil, true},
+		{"*2\r\n:1\r\n", nil, true},
+		{"", nil, true},
+	}
+	for _, tc := range cases {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tc.raw)))
+		if tc.err {
+			if err == nil {
+				t.Errorf("readReply(%q) = %#v, want error", tc.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readReply(%q): %v", tc.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("readReply(%q) = %#v, want %#v", tc.raw, got, tc.want)
+		}
+	}
+
+	_, err := readReply(bufio.NewReader(strings.NewReader("-NOSCRIPT No matching script\r\n")))
+	if !isNoScript(err) {
+		t.Errorf("isNoScript(%v) = false", err)
+	}
+}
+
+func TestScriptSHA(t *testing.T) {
+	if got, want := scriptSHA("return 1"), "e0e1f9fabfc9d4800c877a703b823ac0578ff8db"; got != want {
+		t.Errorf("scriptSHA = %s, want %s", got, want)
+	}
+}
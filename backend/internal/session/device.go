@@ -0,0 +1,82 @@
+package session
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxDeviceName = 128
+	maxUserAgent  = 512
+)
+
+type Device struct {
+	Name      string
+	Platform  string
+	UserAgent string
+	IP        string
+}
+
+var platforms = []struct{ marker, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+var browsers = []struct{ marker, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+func NewDevice(name, userAgent, ip string) Device {
+	d := Device{
+		Platform:  detect(userAgent, platforms),
+		UserAgent: truncate(userAgent, maxUserAgent),
+		IP:        ip,
+	}
+	d.Name = truncate(strings.TrimSpace(name), maxDeviceName)
+	if d.Name == "" {
+		d.Name = defaultName(detect(userAgent, browsers), d.Platform)
+	}
+	return d
+}
+
+func detect(userAgent string, table []struct{ marker, name string }) string {
+	for _, entry := range table {
+		if strings.Contains(userAgent, entry.marker) {
+			return entry.name
+		}
+	}
+	return ""
+}
+
+func defaultName(browser, platform string) string {
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
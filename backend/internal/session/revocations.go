@@ -0,0 +1,70 @@
+package session
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"p2p-chat-app/backend/internal/cluster"
+)
+
+const topicRevoked = "session.revoked"
+
+type Revocation struct {
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId,omitempty"`
+	Keep      string `json:"keep,omitempty"`
+}
+
+func (r Revocation) Matches(userID, sessionID string) bool {
+	if r.UserID != userID {
+		return false
+	}
+	if r.SessionID != "" {
+		return r.SessionID == sessionID
+	}
+	return sessionID != r.Keep
+}
+
+type Revocations struct {
+	bus       cluster.Bus
+	mu        sync.RWMutex
+	listeners []func(Revocation)
+}
+
+func NewRevocations(bus cluster.Bus) *Revocations {
+	r := &Revocations{bus: bus}
+	bus.Subscribe(topicRevoked, r.applyRemote)
+	return r
+}
+
+func (r *Revocations) OnRevoke(fn func(Revocation)) {
+	r.mu.Lock()
+	r.listeners = append(r.listeners, fn)
+	r.mu.Unlock()
+}
+
+func (r *Revocations) Publish(rev Revocation) {
+	if err := r.bus.Publish(topicRevoked, rev); err != nil {
+		log.Printf("session revocation publish error: %v", err)
+	}
+	r.notify(rev)
+}
+
+func (r *Revocations) applyRemote(ev cluster.Event) {
+	var rev Revocation
+	if err := json.Unmarshal(ev.Data, &rev); err != nil {
+		log.Printf("session revocation event decode error: %v", err)
+		return
+	}
+	r.notify(rev)
+}
+
+func (r *Revocations) notify(rev Revocation) {
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(rev)
+	}
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type Info struct {
+	ID           string    `json:"id"`
+	DeviceName   string    `json:"deviceName"`
+	Platform     string    `json:"platform"`
+	UserAgent    string    `json:"userAgent"`
+	LastIP       string    `json:"lastIp"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Current      bool      `json:"current"`
+}
+
+func Create(db execer, userID string, ttl time.Duration, dev Device) (string, error) {
+	sessionID := uuid.NewString()
+	now := time.Now()
+	_, err := db.Exec(`
+		INSERT INTO sessions (session_id, user_id, expires_at, device_name, platform, user_agent, last_ip, last_active_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, sessionID, userID, now.Add(ttl), dev.Name, dev.Platform, dev.UserAgent, dev.IP, now)
+	if err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+func Active(db *sql.DB, sessionID, userID string) (bool, error) {
+	var exists int
+	err := db.QueryRow(`
+		SELECT 1 FROM sessions
+		WHERE session_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	`, sessionID, userID, time.Now()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func RevokeOthers(db execer, userID, keepSessionID string) error {
+	_, err := db.Exec(`
+		UPDATE sessions SET revoked_at = ?
+		WHERE user_id = ? AND session_id <> ? AND revoked_at IS NULL
+	`, time.Now(), userID, keepSessionID)
+	return err
+}
+
+func RevokeAll(db execer, userID string) error {
+	_, err := db.Exec(`
+		UPDATE sessions SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+	`, time.Now(), userID)
+	return err
+}
+
+func Touch(db execer, sessionID, ip string) error {
+	_, err := db.Exec(`
+		UPDATE sessions SET last_ip = ?, last_active_at = ?
+		WHERE session_id = ?
+	`, ip, time.Now(), sessionID)
+	return err
+}
+
+func List(db *sql.DB, userID, currentID string) ([]Info, error) {
+	rows, err := db.Query(`
+		SELECT session_id, device_name, platform, user_agent, last_ip, last_active_at, created_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY COALESCE(last_active_at, created_at) DESC
+	`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Info{}
+	for rows.Next() {
+		var info Info
+		var lastActive sql.NullTime
+		if err := rows.Scan(&info.ID, &info.DeviceName, &info.Platform, &info.UserAgent, &info.LastIP, &lastActive, &info.CreatedAt, &info.ExpiresAt); err != nil {
+			return nil, err
+		}
+		info.LastActiveAt = info.CreatedAt
+		if lastActive.Valid {
+			info.LastActiveAt = lastActive.Time
+		}
+		info.Current = info.ID == currentID
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
+
+func Revoke(db execer, userID, sessionID string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE sessions SET revoked_at = ?
+		WHERE user_id = ? AND session_id = ? AND revoked_at IS NULL
+	`, time.Now(), userID, sessionID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,102 @@
+package tokens
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+const kekSize = 32
+
+var sealedPrefix = []byte("enc1")
+
+const sealedSecretPrefix = "enc1:"
+
+var (
+	ErrMissingKEK = errors.New("signing key encryption key is not configured, set JWT_KEY_ENCRYPTION_KEY or JWT_KEK_FILE")
+	ErrInvalidKEK = errors.New("signing key encryption key must be 32 bytes, base64 encoded")
+)
+
+func LoadKEK(value, file string) ([]byte, error) {
+	if value == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, ErrMissingKEK
+	}
+	kek, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(kek) != kekSize {
+		return nil, ErrInvalidKEK
+	}
+	return kek, nil
+}
+
+func newAEAD(kek []byte) (cipher.AEAD, error) {
+	if len(kek) != kekSize {
+		return nil, ErrInvalidKEK
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealKey(aead cipher.AEAD, kid string, der []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), sealedPrefix...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, der, []byte(kid)), nil
+}
+
+func openKey(aead cipher.AEAD, kid string, stored []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(stored, sealedPrefix) {
+		return stored, false, nil
+	}
+	sealed := stored[len(sealedPrefix):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, true, errors.New("sealed signing key is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	der, err := aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, true, err
+	}
+	return der, true, nil
+}
+
+func (m *Manager) SealSecret(aad, secret string) (string, error) {
+	sealed, err := sealKey(m.aead, aad, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed[len(sealedPrefix):]), nil
+}
+
+func (m *Manager) OpenSecret(aad, stored string) (string, bool, error) {
+	if !strings.HasPrefix(stored, sealedSecretPrefix) {
+		return stored, false, nil
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(stored[len(sealedSecretPrefix):])
+	if err != nil {
+		return "", true, err
+	}
+	secret, _, err := openKey(m.aead, aad, append(append([]byte(nil), sealedPrefix...), raw...))
+	if err != nil {
+		return "", true, err
+	}
+	return string(secret), true, nil
+}
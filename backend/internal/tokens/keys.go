@@ -0,0 +1,137 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+var ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+
+type Key struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+	RetiredAt time.Time
+	ExpiresAt time.Time
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+func generateKey(alg string) (*Key, error) {
+	var priv crypto.Signer
+	switch alg {
+	case AlgEdDSA:
+		_, p, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = p
+	case AlgRS256:
+		p, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		priv = p
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+	key := &Key{Alg: alg, Private: priv, Public: priv.Public(), CreatedAt: time.Now()}
+	der, err := x509.MarshalPKIXPublicKey(key.Public)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:16])
+	return key, nil
+}
+
+func encodeKey(k *Key) ([]byte, []byte, error) {
+	priv, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(k.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, pub, nil
+}
+
+func decodeKey(alg string, privDER, pubDER []byte) (crypto.Signer, crypto.PublicKey, error) {
+	priv, err := x509.ParsePKCS8PrivateKey(privDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, ErrUnsupportedAlg
+	}
+	pub, err := x509.ParsePKIXPublicKey(pubDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			return nil, nil, ErrUnsupportedAlg
+		}
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			return nil, nil, ErrUnsupportedAlg
+		}
+	default:
+		return nil, nil, ErrUnsupportedAlg
+	}
+	return signer, pub, nil
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	switch alg {
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	}
+	return nil
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Alg: k.Alg, Use: "sig"}
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
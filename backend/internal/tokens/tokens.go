@@ -0,0 +1,355 @@
+package tokens
+
+import (
+	"context"
+	"crypto/cipher"
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	PurposeMFA = "mfa"
+
+	reloadInterval  = time.Minute
+	minReloadOnMiss = 5 * time.Second
+	clockLeeway     = 30 * time.Second
+
+	rotationLock        = "p2p-chat.signing-key-rotation"
+	rotationLockTimeout = 10
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrWrongPurpose = errors.New("token has wrong purpose")
+	ErrRotationLock = errors.New("timed out waiting for the signing key rotation lock")
+)
+
+type Config struct {
+	Alg         string
+	Issuer      string
+	Audience    string
+	RotateEvery time.Duration
+	VerifyGrace time.Duration
+	KEK         []byte
+}
+
+type Claims struct {
+	UserID    string `json:"userId"`
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Manager struct {
+	db   *sql.DB
+	cfg  Config
+	aead cipher.AEAD
+
+	mu         sync.RWMutex
+	active     *Key
+	keys       map[string]*Key
+	lastReload time.Time
+}
+
+func NewManager(db *sql.DB, cfg Config) (*Manager, error) {
+	if signingMethod(cfg.Alg) == nil {
+		return nil, ErrUnsupportedAlg
+	}
+	aead, err := newAEAD(cfg.KEK)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{db: db, cfg: cfg, aead: aead, keys: make(map[string]*Key)}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	if err := m.rotateIfDue(); err != nil {
+		return nil, err
+	}
+	go m.loop()
+	return m, nil
+}
+
+func (m *Manager) Issue(userID, sessionID string, ttl time.Duration) (string, error) {
+	return m.sign(Claims{UserID: userID, SessionID: sessionID}, ttl)
+}
+
+func (m *Manager) IssueChallenge(userID string, ttl time.Duration) (string, error) {
+	return m.sign(Claims{UserID: userID, Purpose: PurposeMFA}, ttl)
+}
+
+func (m *Manager) Parse(token string) (*Claims, error) {
+	claims, err := m.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, ErrWrongPurpose
+	}
+	return claims, nil
+}
+
+func (m *Manager) ParseChallenge(token string) (*Claims, error) {
+	claims, err := m.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFA {
+		return nil, ErrWrongPurpose
+	}
+	return claims, nil
+}
+
+func (m *Manager) JWKS() []JWK {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]JWK, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k.JWK())
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
+
+func (m *Manager) sign(claims Claims, ttl time.Duration) (string, error) {
+	m.mu.RLock()
+	key := m.active
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrUnknownKey
+	}
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Issuer:    m.cfg.Issuer,
+		Audience:  jwt.ClaimStrings{m.cfg.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	token := jwt.NewWithClaims(signingMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+func (m *Manager) parse(tokenStr string) (*Claims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{AlgEdDSA, AlgRS256}),
+		jwt.WithIssuer(m.cfg.Issuer),
+		jwt.WithAudience(m.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockLeeway),
+	)
+	parsed, err := parser.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := m.lookup(kid)
+		if key == nil {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := parsed.Claims.(*Claims); ok && parsed.Valid {
+		return claims, nil
+	}
+	return nil, jwt.ErrTokenInvalidClaims
+}
+
+func (m *Manager) lookup(kid string) *Key {
+	if kid == "" {
+		return nil
+	}
+	m.mu.RLock()
+	key := m.keys[kid]
+	stale := time.Since(m.lastReload) > minReloadOnMiss
+	m.mu.RUnlock()
+	if key != nil || !stale {
+		return key
+	}
+	if err := m.reload(); err != nil {
+		log.Printf("signing key reload error: %v", err)
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+func (m *Manager) reload() error {
+	rows, err := m.db.Query(`
+		SELECT kid, alg, private_key, public_key, created_at, retired_at, expires_at
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > ?
+	`, time.Now())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*Key)
+	legacy := make(map[string][]byte)
+	var active *Key
+	for rows.Next() {
+		var k Key
+		var stored, pubDER []byte
+		var retiredAt, expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Alg, &stored, &pubDER, &k.CreatedAt, &retiredAt, &expiresAt); err != nil {
+			return err
+		}
+		privDER, sealed, err := openKey(m.aead, k.ID, stored)
+		if err != nil {
+			log.Printf("skipping signing key %s: %v", k.ID, err)
+			continue
+		}
+		if !sealed {
+			legacy[k.ID] = stored
+		}
+		k.Private, k.Public, err = decodeKey(k.Alg, privDER, pubDER)
+		if err != nil {
+			log.Printf("skipping signing key %s: %v", k.ID, err)
+			continue
+		}
+		k.RetiredAt = retiredAt.Time
+		k.ExpiresAt = expiresAt.Time
+		keys[k.ID] = &k
+		if !retiredAt.Valid && k.Alg == m.cfg.Alg && (active == nil || k.CreatedAt.After(active.CreatedAt)) {
+			active = &k
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for kid, der := range legacy {
+		if _, ok := keys[kid]; ok {
+			m.sealLegacy(kid, der)
+		}
+	}
+	m.mu.Lock()
+	m.keys = keys
+	m.active = active
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) sealLegacy(kid string, der []byte) {
+	sealed, err := sealKey(m.aead, kid, der)
+	if err != nil {
+		log.Printf("signing key %s encryption error: %v", kid, err)
+		return
+	}
+	_, err = m.db.Exec(`
+		UPDATE signing_keys SET private_key = ? WHERE kid = ? AND private_key = ?
+	`, sealed, kid, der)
+	if err != nil {
+		log.Printf("signing key %s encryption error: %v", kid, err)
+		return
+	}
+	log.Printf("encrypted stored signing key %s", kid)
+}
+
+func (m *Manager) rotationDue() bool {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+	return active == nil || time.Since(active.CreatedAt) >= m.cfg.RotateEvery
+}
+
+func (m *Manager) rotateIfDue() error {
+	if !m.rotationDue() {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", rotationLock, rotationLockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return ErrRotationLock
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "DO RELEASE_LOCK(?)", rotationLock); err != nil {
+			log.Printf("signing key rotation unlock error: %v", err)
+		}
+	}()
+	if err := m.reload(); err != nil {
+		return err
+	}
+	if !m.rotationDue() {
+		return nil
+	}
+
+	key, err := generateKey(m.cfg.Alg)
+	if err != nil {
+		return err
+	}
+	privDER, pubDER, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealKey(m.aead, key.ID, privDER)
+	if err != nil {
+		return err
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO signing_keys (kid, alg, private_key, public_key, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key.ID, key.Alg, sealed, pubDER, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE signing_keys SET retired_at = ?, expires_at = ?
+		WHERE retired_at IS NULL AND kid <> ?
+	`, now, now.Add(m.cfg.VerifyGrace), key.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("rotated signing key, new kid %s", key.ID)
+	return m.reload()
+}
+
+func (m *Manager) loop() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := m.reload(); err != nil {
+			log.Printf("signing key reload error: %v", err)
+			continue
+		}
+		if err := m.rotateIfDue(); err != nil {
+			log.Printf("signing key rotation error: %v", err)
+		}
+		if _, err := m.db.Exec(`DELETE FROM signing_keys WHERE expires_at < ?`, time.Now()); err != nil {
+			log.Printf("signing key cleanup error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testKEK() []byte {
+	return bytes.Repeat([]byte{7}, kekSize)
+}
+
+func TestLoadKEK(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKEK())
+	kek, err := LoadKEK(encoded, "")
+	if err != nil || !bytes.Equal(kek, testKEK()) {
+		t.Fatalf("LoadKEK(value) = %x, %v", kek, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(file, []byte(encoded+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kek, err = LoadKEK("", file)
+	if err != nil || !bytes.Equal(kek, testKEK()) {
+		t.Fatalf("LoadKEK(file) = %x, %v", kek, err)
+	}
+
+	if _, err := LoadKEK("", ""); err != ErrMissingKEK {
+		t.Errorf("LoadKEK with nothing configured error = %v, want %v", err, ErrMissingKEK)
+	}
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := LoadKEK(bad, ""); err != ErrInvalidKEK {
+			t.Errorf("LoadKEK(%q) error = %v, want %v", bad, err, ErrInvalidKEK)
+		}
+	}
+	if _, err := LoadKEK("", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadKEK with a missing file succeeded")
+	}
+}
+
+func TestSealKeyRoundTrip(t *testing.T) {
+	aead, err := newAEAD(testKEK())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := generateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _, err := encodeKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealKey(aead, key.ID, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, der) {
+		t.Fatal("sealed key contains the plaintext DER")
+	}
+
+	opened, wasSealed, err := openKey(aead, key.ID, sealed)
+	if err != nil || !wasSealed || !bytes.Equal(opened, der) {
+		t.Fatalf("openKey = %v, %v", wasSealed, err)
+	}
+	if _, _, err := openKey(aead, "other-kid", sealed); err == nil {
+		t.Error("sealed key opened under a different kid")
+	}
+	otherAEAD, _ := newAEAD(bytes.Repeat([]byte{8}, kekSize))
+	if _, _, err := openKey(otherAEAD, key.ID, sealed); err == nil {
+		t.Error("sealed key opened with a different KEK")
+	}
+	if _, _, err := openKey(aead, key.ID, sealedPrefix); err == nil {
+		t.Error("truncated sealed key opened")
+	}
+
+	legacy, wasSealed, err := openKey(aead, key.ID, der)
+	if err != nil || wasSealed || !bytes.Equal(legacy, der) {
+		t.Errorf("legacy key openKey = %v, %v", wasSealed, err)
+	}
+}
+
+func testManager(t *testing.T, alg string) *Manager {
+	t.Helper()
+	key, err := generateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Manager{
+		cfg:        Config{Alg: alg, Issuer: "iss", Audience: "aud"},
+		active:     key,
+		keys:       map[string]*Key{key.ID: key},
+		lastReload: time.Now(),
+	}
+}
+
+func TestIssueAndParse(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		m := testManager(t, alg)
+		token, err := m.Issue("user-1", "session-1", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := m.Parse(token)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", alg, err)
+		}
+		if claims.UserID != "user-1" || claims.SessionID != "session-1" {
+			t.Errorf("%s: claims = %+v", alg, claims)
+		}
+		if _, err := m.ParseChallenge(token); err != ErrWrongPurpose {
+			t.Errorf("%s: ParseChallenge(access token) error = %v", alg, err)
+		}
+	}
+}
+
+func TestParseLeeway(t *testing.T) {
+	m := testManager(t, AlgEdDSA)
+	sign := func(issued, expires time.Time) string {
+		claims := Claims{UserID: "u", RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "iss",
+			Audience:  jwt.ClaimStrings{"aud"},
+			IssuedAt:  jwt.NewNumericDate(issued),
+			NotBefore: jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		}}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = m.active.ID
+		s, err := token.SignedString(m.active.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	now := time.Now()
+
+	if _, err := m.Parse(sign(now.Add(-time.Hour), now.Add(-10*time.Second))); err != nil {
+		t.Errorf("token expired within the leeway rejected: %v", err)
+	}
+	if _, err := m.Parse(sign(now.Add(10*time.Second), now.Add(time.Hour))); err != nil {
+		t.Errorf("token issued slightly in the future rejected: %v", err)
+	}
+	if _, err := m.Parse(sign(now.Add(-time.Hour), now.Add(-2*clockLeeway))); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("expired token error = %v, want %v", err, jwt.ErrTokenExpired)
+	}
+	if _, err := m.Parse(sign(now.Add(2*clockLeeway), now.Add(time.Hour))); err == nil {
+		t.Error("token issued well in the future accepted")
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	aead, err := newAEAD(bytes.Repeat([]byte{9}, kekSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{aead: aead}
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	stored, err := m.SealSecret("totp:u1", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, secret) || len(stored) > 255 {
+		t.Fatalf("sealed secret = %q", stored)
+	}
+	got, sealed, err := m.OpenSecret("totp:u1", stored)
+	if err != nil || !sealed || got != secret {
+		t.Fatalf("OpenSecret = %q, %v, %v", got, sealed, err)
+	}
+	if _, _, err := m.OpenSecret("totp:u2", stored); err == nil {
+		t.Error("secret opened for a different user")
+	}
+	got, sealed, err = m.OpenSecret("totp:u1", secret)
+	if err != nil || sealed || got != secret {
+		t.Errorf("legacy OpenSecret = %q, %v, %v", got, sealed, err)
+	}
+}
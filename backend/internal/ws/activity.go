@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	activityThrottle = 2 * time.Second
+	activityTTL      = 6 * time.Second
+)
+
+type activityPayload struct {
+	State     string `json:"state"`
+	ExpiresIn int64  `json:"expiresIn,omitempty"`
+}
+
+type activityKey struct {
+	from    string
+	to      string
+	groupID string
+}
+
+type activityEntry struct {
+	state      string
+	lastSent   time.Time
+	recipients []string
+	timer      *time.Timer
+}
+
+type activityTracker struct {
+	mu      sync.Mutex
+	entries map[activityKey]*activityEntry
+	send    func(from, groupID string, recipients []string, state string)
+}
+
+func newActivityTracker(send func(from, groupID string, recipients []string, state string)) *activityTracker {
+	return &activityTracker{
+		entries: make(map[activityKey]*activityEntry),
+		send:    send,
+	}
+}
+
+func (t *activityTracker) start(key activityKey, state string, recipients []string) {
+	t.mu.Lock()
+	now := time.Now()
+	entry, ok := t.entries[key]
+	if ok && entry.state == state && now.Sub(entry.lastSent) < activityThrottle {
+		entry.timer.Reset(activityTTL)
+		t.mu.Unlock()
+		return
+	}
+	if ok {
+		entry.timer.Stop()
+	}
+	entry = &activityEntry{state: state, lastSent: now, recipients: recipients}
+	entry.timer = time.AfterFunc(activityTTL, func() { t.expire(key, entry) })
+	t.entries[key] = entry
+	t.mu.Unlock()
+	t.send(key.from, key.groupID, recipients, state)
+}
+
+func (t *activityTracker) refresh(key activityKey, state string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[key]
+	if !ok || entry.state != state || time.Since(entry.lastSent) >= activityThrottle {
+		return false
+	}
+	entry.timer.Reset(activityTTL)
+	return true
+}
+
+func (t *activityTracker) stop(key activityKey) {
+	t.mu.Lock()
+	entry, ok := t.entries[key]
+	if ok {
+		entry.timer.Stop()
+		delete(t.entries, key)
+	}
+	t.mu.Unlock()
+	if ok {
+		t.send(key.from, key.groupID, entry.recipients, "")
+	}
+}
+
+func (t *activityTracker) expire(key activityKey, entry *activityEntry) {
+	t.mu.Lock()
+	if t.entries[key] != entry {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.entries, key)
+	t.mu.Unlock()
+	t.send(key.from, key.groupID, entry.recipients, "")
+}
+
+func (t *activityTracker) clear(from string) {
+	t.mu.Lock()
+	stopped := make(map[activityKey]*activityEntry)
+	for key, entry := range t.entries {
+		if key.from == from {
+			entry.timer.Stop()
+			delete(t.entries, key)
+			stopped[key] = entry
+		}
+	}
+	t.mu.Unlock()
+	for key, entry := range stopped {
+		t.send(key.from, key.groupID, entry.recipients, "")
+	}
+}
+
+func (h *Handler) handleActivity(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	key := activityKey{from: c.UserID}
+	var allowed bool
+	var err error
+	if msg.GroupID != "" {
+		key.groupID = msg.GroupID
+		allowed, err = h.Authz.IsMember(msg.GroupID, c.UserID)
+	} else {
+		if msg.To == "" {
+			return nil, newFrameError(CodeInvalidMessage).withField("to")
+		}
+		key.to = msg.To
+		allowed, err = h.Authz.AreFriends(c.UserID, msg.To)
+	}
+	if err != nil {
+		return nil, newFrameError(CodeAuthorizationFailed)
+	}
+	if !allowed {
+		return nil, newFrameError(CodeNotAllowed)
+	}
+
+	state := activityTypes[msg.Type]
+	if state == "" {
+		h.activity.stop(key)
+		return nil, nil
+	}
+	if h.activity.refresh(key, state) {
+		return nil, nil
+	}
+	recipients := []string{msg.To}
+	if msg.GroupID != "" {
+		recipients, err = h.groupRecipients(msg.GroupID, c.UserID)
+		if err == errNotGroupMember {
+			return nil, newFrameError(CodeNotAllowed)
+		}
+		if err != nil {
+			return nil, newFrameError(CodeAuthorizationFailed)
+		}
+	}
+	h.activity.start(key, state, recipients)
+	return nil, nil
+}
+
+func (h *Handler) sendActivity(from, groupID string, recipients []string, state string) {
+	msgType := "activity.stop"
+	payload := activityPayload{State: "idle"}
+	if state != "" {
+		msgType = "activity." + state
+		payload = activityPayload{State: state, ExpiresIn: activityTTL.Milliseconds()}
+	}
+	data, _ := json.Marshal(payload)
+	msg := SignalMessage{
+		Type:    msgType,
+		From:    from,
+		GroupID: groupID,
+		Payload: data,
+	}
+	for _, id := range recipients {
+		msg.To = id
+		h.Hub.Send(id, msg)
+	}
+}
+
+func containsUser(ids []string, userID string) bool {
+	for _, id := range ids {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
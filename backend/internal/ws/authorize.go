@@ -2,39 +2,48 @@ package ws
 
 import (
 	"database/sql"
+
+	"p2p-chat-app/backend/internal/presence"
 )
 
 func (h *Handler) allowedToSignal(from, to, groupID string) (bool, error) {
 	if groupID != "" {
-		return bothInGroup(h.DB, from, to, groupID)
+		return h.Authz.BothInGroup(from, to, groupID)
 	}
-	return areFriends(h.DB, from, to)
+	return h.Authz.AreFriends(from, to)
 }
 
-func areFriends(db *sql.DB, userA, userB string) (bool, error) {
-	var exists int
-	err := db.QueryRow(`
-		SELECT 1 FROM friends
-		WHERE (user_id = ? AND friend_user_id = ?) OR (user_id = ? AND friend_user_id = ?)
-		LIMIT 1
-	`, userA, userB, userB, userA).Scan(&exists)
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
+func groupMembers(db *sql.DB, groupID string) ([]string, error) {
+	rows, err := db.Query(`SELECT user_id FROM group_members WHERE group_id = ?`, groupID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return true, nil
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
-func bothInGroup(db *sql.DB, userA, userB, groupID string) (bool, error) {
-	var count int
-	err := db.QueryRow(`
-		SELECT COUNT(1) FROM group_members
-		WHERE group_id = ? AND user_id IN (?, ?)
-	`, groupID, userA, userB).Scan(&count)
+func (h *Handler) relation(userA, userB string) (presence.Relation, error) {
+	friends, err := h.Authz.AreFriends(userA, userB)
 	if err != nil {
-		return false, err
+		return presence.RelationOther, err
+	}
+	if friends {
+		return presence.RelationFriend, nil
+	}
+	shared, err := h.Authz.SharesGroup(userA, userB)
+	if err != nil {
+		return presence.RelationOther, err
+	}
+	if shared {
+		return presence.RelationGroup, nil
 	}
-	return count == 2, nil
+	return presence.RelationOther, nil
 }
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var errNotGroupMember = errors.New("not a group member")
+
+type deliveryReport struct {
+	GroupID   string   `json:"groupId"`
+	Type      string   `json:"type"`
+	Delivered []string `json:"delivered"`
+	Offline   []string `json:"offline"`
+}
+
+func (h *Handler) groupRecipients(groupID, from string) ([]string, error) {
+	members, err := groupMembers(h.DB, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsUser(members, from) {
+		return nil, errNotGroupMember
+	}
+	recipients := make([]string, 0, len(members))
+	for _, id := range members {
+		if id != from {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients, nil
+}
+
+func (h *Handler) handleGroupBroadcast(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	recipients, err := h.groupRecipients(msg.GroupID, c.UserID)
+	if err == errNotGroupMember {
+		return nil, newFrameError(CodeNotAllowed)
+	}
+	if err != nil {
+		return nil, newFrameError(CodeAuthorizationFailed)
+	}
+	requestID := msg.ID
+	msg.ID = ""
+
+	report := deliveryReport{
+		GroupID:   msg.GroupID,
+		Type:      msg.Type,
+		Delivered: make([]string, 0, len(recipients)),
+		Offline:   make([]string, 0),
+	}
+	for _, id := range recipients {
+		msg.To = id
+		if h.Hub.Send(id, msg) {
+			report.Delivered = append(report.Delivered, id)
+		} else {
+			report.Offline = append(report.Offline, id)
+		}
+	}
+
+	if requestID != "" {
+		return report, nil
+	}
+	payload, _ := json.Marshal(report)
+	h.Hub.Send(c.UserID, SignalMessage{
+		Type:    "delivery.report",
+		To:      c.UserID,
+		GroupID: msg.GroupID,
+		Payload: payload,
+	})
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"p2p-chat-app/backend/pkg/cbor"
+)
+
+const (
+	subprotocolJSON = "p2p-chat.v2.json"
+	subprotocolCBOR = "p2p-chat.v2.cbor"
+)
+
+type codec interface {
+	Name() string
+	MessageType() int
+	Encode(msg SignalMessage) ([]byte, error)
+	Decode(data []byte, msg *SignalMessage) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) MessageType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(msg SignalMessage) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Decode(data []byte, msg *SignalMessage) error {
+	return json.Unmarshal(data, msg)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return "cbor" }
+
+func (cborCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (cborCodec) Encode(msg SignalMessage) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.FromJSON(data)
+}
+
+func (cborCodec) Decode(data []byte, msg *SignalMessage) error {
+	doc, err := cbor.ToJSON(data)
+	if err != nil {
+		return err
+	}
+	if len(doc) == 0 || doc[0] != '{' {
+		return cbor.ErrUnsupportedType
+	}
+	return json.Unmarshal(doc, msg)
+}
+
+var subprotocols = []string{subprotocolCBOR, subprotocolJSON}
+
+func codecFor(subprotocol string) codec {
+	if subprotocol == subprotocolCBOR {
+		return cborCodec{}
+	}
+	return jsonCodec{}
+}
+
+func requestsDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name := strings.TrimSpace(strings.SplitN(ext, ";", 2)[0])
+			if strings.EqualFold(name, "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCBORCodecRoundTrip(t *testing.T) {
+	msg := SignalMessage{
+		ID:      "1",
+		Type:    "offer",
+		To:      "bob",
+		GroupID: "g1",
+		Payload: json.RawMessage(`{"n":2,"sdp":"v=0"}`),
+	}
+	var c cborCodec
+	data, err := c.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SignalMessage
+	if err := c.Decode(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("round trip = %+v, want %+v", got, msg)
+	}
+}
+
+func TestCBORCodecOmitsEmptyFields(t *testing.T) {
+	data, err := cborCodec{}.Encode(SignalMessage{Type: "ack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"type": "ack"}
+	if want := "a164747970656361636b"; hex.EncodeToString(data) != want {
+		t.Errorf("Encode = %x, want %s", data, want)
+	}
+}
+
+func TestCBORCodecDecodeRejects(t *testing.T) {
+	for _, h := range []string{
+		"83010203",               // not a map
+		"a1647479706501",         // {"type": 1}
+		"a164747970656361636b00", // trailing data
+		"a164747970656261c3",     // {"type": invalid utf-8}
+	} {
+		data, _ := hex.DecodeString(h)
+		var msg SignalMessage
+		if err := (cborCodec{}).Decode(data, &msg); err == nil {
+			t.Errorf("Decode(%s) succeeded, want error", h)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	CodeInvalidMessage       = "invalid_message"
+	CodeUnsupportedType      = "unsupported_type"
+	CodeMissingGroupID       = "missing_group_id"
+	CodeInvalidPayload       = "invalid_payload"
+	CodeNotAllowed           = "not_allowed"
+	CodeInsufficientScope    = "insufficient_scope"
+	CodeAuthorizationFailed  = "authorization_failed"
+	CodeTargetOffline        = "target_offline"
+	CodeTooManySubscriptions = "too_many_subscriptions"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+)
+
+type errorSpec struct {
+	message    string
+	retryable  bool
+	retryAfter time.Duration
+}
+
+var errorCatalogue = map[string]errorSpec{
+	CodeInvalidMessage:       {message: "invalid signaling message"},
+	CodeUnsupportedType:      {message: "unsupported signaling type"},
+	CodeMissingGroupID:       {message: "missing groupId for group signaling"},
+	CodeInvalidPayload:       {message: "invalid payload"},
+	CodeNotAllowed:           {message: "not allowed"},
+	CodeInsufficientScope:    {message: "api key lacks required scope"},
+	CodeAuthorizationFailed:  {message: "authorization failed", retryable: true, retryAfter: time.Second},
+	CodeTargetOffline:        {message: "target offline", retryable: true, retryAfter: 5 * time.Second},
+	CodeTooManySubscriptions: {message: "too many subscriptions"},
+	CodeRateLimited:          {message: "rate limit exceeded", retryable: true, retryAfter: time.Second},
+	CodeInternal:             {message: "internal error", retryable: true, retryAfter: time.Second},
+}
+
+type FrameError struct {
+	Code       string
+	Message    string
+	Field      string
+	RetryAfter time.Duration
+}
+
+func newFrameError(code string) *FrameError {
+	return &FrameError{Code: code, Message: errorCatalogue[code].message}
+}
+
+func (e *FrameError) Error() string {
+	return e.Message
+}
+
+func (e *FrameError) withMessage(message string) *FrameError {
+	e.Message = message
+	return e
+}
+
+func (e *FrameError) withField(field string) *FrameError {
+	e.Field = field
+	return e
+}
+
+func (e *FrameError) withRetryAfter(d time.Duration) *FrameError {
+	e.RetryAfter = d
+	return e
+}
+
+type errorPayload struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	Field        string `json:"field,omitempty"`
+	Retryable    bool   `json:"retryable"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+type rejection struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+func errorFrame(id string, e *FrameError) SignalMessage {
+	spec := errorCatalogue[e.Code]
+	retryAfter := spec.retryAfter
+	if e.RetryAfter > 0 {
+		retryAfter = e.RetryAfter
+	}
+	payload, _ := json.Marshal(errorPayload{
+		Code:         e.Code,
+		Message:      e.Message,
+		Field:        e.Field,
+		Retryable:    spec.retryable,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+	return SignalMessage{Type: "error", ID: id, Payload: payload}
+}
+
+func ackFrame(id string, result interface{}) SignalMessage {
+	msg := SignalMessage{Type: "ack", ID: id}
+	if result != nil {
+		msg.Payload, _ = json.Marshal(result)
+	}
+	return msg
+}
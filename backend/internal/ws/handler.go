@@ -1,88 +1,249 @@
 package ws
 
 import (
+	"compress/flate"
 	"database/sql"
 	"encoding/json"
+	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"p2p-chat-app/backend/pkg/utils"
+	"p2p-chat-app/backend/internal/apikey"
+	"p2p-chat-app/backend/internal/authz"
+	"p2p-chat-app/backend/internal/icepolicy"
+	"p2p-chat-app/backend/internal/middleware"
+	"p2p-chat-app/backend/internal/presence"
+	"p2p-chat-app/backend/internal/session"
+	"p2p-chat-app/backend/internal/tokens"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 type Handler struct {
-	Hub       *Hub
-	DB        *sql.DB
-	JWTSecret string
+	Hub         *Hub
+	DB          *sql.DB
+	Presence    *presence.Store
+	ICEPolicies *icepolicy.Store
+	Authz       *authz.Cache
+	Tokens      *tokens.Manager
+	Sessions    *session.Revocations
+	IdleAfter   time.Duration
+
+	AllowedOrigins []string
+	WriteTimeout   time.Duration
+	StallTimeout   time.Duration
+	MaxQueue       int
+	ReadLimit      int64
+	MaxSDPSize     int
+
+	RateLimit       RateLimit
+	TypeLimits      map[string]RateLimit
+	ThrottleAfter   int
+	DisconnectAfter int
+	ThrottleDelay   time.Duration
+
+	upgrader websocket.Upgrader
+	activity *activityTracker
+	subs     *subscriptions
+	limiter  *rateLimiter
 }
 
 type SignalMessage struct {
+	ID      string          `json:"id,omitempty"`
 	Type    string          `json:"type"`
-	From    string          `json:"from"`
-	To      string          `json:"to"`
+	From    string          `json:"from,omitempty"`
+	To      string          `json:"to,omitempty"`
 	GroupID string          `json:"groupId,omitempty"`
-	Payload json.RawMessage `json:"payload"`
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
 type Client struct {
-	UserID string
-	Conn   *websocket.Conn
-	Send   chan []byte
+	UserID        string
+	SessionID     string
+	AuthSessionID string
+	Features      map[string]struct{}
+	Conn          *websocket.Conn
+
+	// nil for user sessions, which are not restricted by scope
+	scopes []string
+	codec  codec
+	out    *outQueue
+
+	lastActive atomic.Int64
+	idle       atomic.Bool
+}
+
+func NewHandler(hub *Hub, db *sql.DB, store *presence.Store, policies *icepolicy.Store, cache *authz.Cache, manager *tokens.Manager, sessions *session.Revocations) *Handler {
+	h := &Handler{
+		Hub:          hub,
+		DB:           db,
+		Presence:     store,
+		ICEPolicies:  policies,
+		Authz:        cache,
+		Tokens:       manager,
+		Sessions:     sessions,
+		IdleAfter:    5 * time.Minute,
+		WriteTimeout: 10 * time.Second,
+		StallTimeout: 30 * time.Second,
+		MaxQueue:     256,
+		ReadLimit:    64 * 1024,
+		MaxSDPSize:   32 * 1024,
+
+		RateLimit:       RateLimit{RPS: 20, Burst: 40},
+		ThrottleAfter:   5,
+		DisconnectAfter: 20,
+		ThrottleDelay:   time.Second,
+	}
+	h.TypeLimits = mustParseRateLimits(DefaultTypeLimits)
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin:       h.checkOrigin,
+		Subprotocols:      subprotocols,
+		EnableCompression: true,
+	}
+	h.activity = newActivityTracker(h.sendActivity)
+	h.subs = newSubscriptions()
+	h.limiter = newRateLimiter()
+	store.OnChange(h.NotifyPresence)
+	policies.OnChange(h.notifyICEPolicy)
+	sessions.OnRevoke(hub.Revoke)
+	return h
 }
 
 func (h *Handler) ServeWS(c *gin.Context) {
-	userID, ok := h.authenticate(c)
+	userID, authSessionID, scopes, ok := h.authenticate(c)
 	if !ok {
 		return
 	}
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
-	client := &Client{UserID: userID, Conn: conn, Send: make(chan []byte, 32)}
+	conn.SetReadLimit(h.ReadLimit)
+	cd := codecFor(conn.Subprotocol())
+	compressed := h.upgrader.EnableCompression && requestsDeflate(c.Request)
+	if compressed {
+		_ = conn.SetCompressionLevel(flate.BestSpeed)
+	}
+	policy, err := h.ICEPolicies.Get(userID)
+	if err != nil {
+		log.Printf("ice policy load error: %v", err)
+	}
+	sessionID, features, ok := h.handshake(conn, cd, compressed, policy)
+	if !ok {
+		return
+	}
+	client := &Client{
+		UserID:        userID,
+		SessionID:     sessionID,
+		AuthSessionID: authSessionID,
+		Features:      features,
+		Conn:          conn,
+		scopes:        scopes,
+		codec:         cd,
+		out:           newOutQueue(h.MaxQueue),
+	}
+	if err := session.Touch(h.DB, authSessionID, c.ClientIP()); err != nil {
+		log.Printf("session touch error: %v", err)
+	}
+	client.lastActive.Store(time.Now().UnixNano())
 	h.Hub.Register(client)
-	h.setPresence(userID, "online")
-	h.notifyFriendsPresence(userID, "online")
+	h.setPresence(userID, func(s *presence.State) bool {
+		s.Connect()
+		return true
+	})
 
-	go client.writeLoop()
+	go client.writeLoop(h)
 	client.readLoop(h)
 }
 
-func (h *Handler) authenticate(c *gin.Context) (string, bool) {
-	auth := c.GetHeader("Authorization")
-	token := ""
-	if auth != "" {
+func (h *Handler) authenticate(c *gin.Context) (string, string, []string, bool) {
+	if !h.checkOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+		return "", "", nil, false
+	}
+	var userID, sessionID string
+	if ticket := c.Query("ticket"); ticket != "" {
+		var ok bool
+		var err error
+		userID, sessionID, ok, err = redeemTicket(h.DB, ticket, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return "", "", nil, false
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ticket"})
+			return "", "", nil, false
+		}
+	} else {
+		auth := c.GetHeader("Authorization")
 		parts := strings.Split(auth, " ")
-		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-			token = parts[1]
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing ticket"})
+			return "", "", nil, false
+		}
+		if apikey.IsKey(parts[1]) {
+			return h.authenticateKey(c, parts[1])
+		}
+		claims, err := h.Tokens.Parse(parts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return "", "", nil, false
 		}
+		userID, sessionID = claims.UserID, claims.SessionID
 	}
-	if token == "" {
-		token = c.Query("token")
+	active, err := session.Active(h.DB, sessionID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return "", "", nil, false
 	}
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-		return "", false
+	if !active {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+		return "", "", nil, false
 	}
-	claims, err := utils.ParseToken(token, h.JWTSecret)
+	return userID, sessionID, nil, true
+}
+
+func (h *Handler) authenticateKey(c *gin.Context, raw string) (string, string, []string, bool) {
+	key, err := apikey.Authenticate(h.DB, raw, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return "", false
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return "", "", nil, false
+	}
+	if key == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		return "", "", nil, false
+	}
+	if !key.HasScope(apikey.ScopeSignalSend) && !key.HasScope(apikey.ScopePresenceRead) && !key.HasScope(apikey.ScopePresenceWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "api key lacks required scope"})
+		return "", "", nil, false
+	}
+	return key.UserID, apikey.SessionID(key.ID), append([]string{}, key.Scopes...), true
+}
+
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
-	return claims.UserID, true
+	return middleware.OriginAllowed(h.AllowedOrigins, origin)
 }
 
 func (c *Client) readLoop(h *Handler) {
 	defer func() {
-		h.Hub.Unregister(c.UserID)
-		h.setPresence(c.UserID, "offline")
-		h.notifyFriendsPresence(c.UserID, "offline")
+		last := h.Hub.Unregister(c)
+		c.out.close(websocket.CloseNormalClosure)
+		c.out.drain()
+		if last {
+			h.activity.clear(c.UserID)
+			h.subs.clear(c.UserID)
+			h.setPresence(c.UserID, func(s *presence.State) bool {
+				s.Disconnect()
+				return true
+			})
+		}
 		_ = c.Conn.Close()
 	}()
 	_ = c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -92,54 +253,194 @@ func (c *Client) readLoop(h *Handler) {
 	})
 
 	for {
-		var msg SignalMessage
-		if err := c.Conn.ReadJSON(&msg); err != nil {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
 			return
 		}
-		msg.From = c.UserID
-		if msg.To == "" || msg.Type == "" {
-			c.Send <- []byte(`{"error":"invalid signaling message"}`)
-			continue
+		var msg SignalMessage
+		decodeErr := c.codec.Decode(data, &msg)
+		allowed, open := c.limit(h, msg)
+		if !open {
+			return
 		}
-		if !isAllowedSignalType(msg.Type) {
-			c.Send <- []byte(`{"error":"unsupported signaling type"}`)
+		if !allowed {
 			continue
 		}
-		if isGroupSignal(msg.Type) && msg.GroupID == "" {
-			c.Send <- []byte(`{"error":"missing groupId for group signaling"}`)
+		if decodeErr != nil {
+			c.reply(errorFrame("", newFrameError(CodeInvalidMessage)))
 			continue
 		}
-		allowed, err := h.allowedToSignal(c.UserID, msg.To, msg.GroupID)
-		if err != nil {
-			c.Send <- []byte(`{"error":"authorization failed"}`)
+		msg.From = c.UserID
+		h.markActive(c)
+		result, ferr := h.dispatch(c, msg)
+		if ferr != nil {
+			c.reply(errorFrame(msg.ID, ferr))
 			continue
 		}
-		if !allowed {
-			c.Send <- []byte(`{"error":"not allowed"}`)
-			continue
+		if msg.ID != "" {
+			c.reply(ackFrame(msg.ID, result))
 		}
-		if ok := h.Hub.Send(msg.To, msg); !ok {
-			c.Send <- []byte(`{"error":"target offline"}`)
+	}
+}
+
+func (c *Client) limit(h *Handler, msg SignalMessage) (bool, bool) {
+	p, strikes, wait := h.checkRate(c.UserID, msg.Type)
+	switch p {
+	case penaltyNone:
+		return true, true
+	case penaltyDisconnect:
+		closeWith(c.Conn, closeRateLimited, closeReason(closeRateLimited))
+		return false, false
+	}
+	c.reply(errorFrame(msg.ID, newFrameError(CodeRateLimited).withRetryAfter(wait)))
+	if p == penaltyThrottle {
+		time.Sleep(h.throttleDelay(strikes))
+	}
+	return false, true
+}
+
+func (h *Handler) dispatch(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	if scope := frameScope(msg.Type); scope != "" && !c.hasScope(scope) {
+		return nil, newFrameError(CodeInsufficientScope).withField("type")
+	}
+	switch msg.Type {
+	case "":
+		return nil, newFrameError(CodeInvalidMessage).withField("type")
+	case "presence.heartbeat":
+		return nil, nil
+	case "presence.set":
+		return h.handlePresenceSet(c, msg)
+	case "presence.subscribe":
+		return h.handlePresenceSubscribe(c, msg)
+	case "presence.unsubscribe":
+		return h.handlePresenceUnsubscribe(c, msg)
+	}
+	if isActivity(msg.Type) {
+		return h.handleActivity(c, msg)
+	}
+	if !isAllowedSignalType(msg.Type) {
+		return nil, newFrameError(CodeUnsupportedType).withField("type")
+	}
+	if isGroupSignal(msg.Type) && msg.GroupID == "" {
+		return nil, newFrameError(CodeMissingGroupID).withField("groupId")
+	}
+	if ferr := h.validatePayload(msg); ferr != nil {
+		return nil, ferr
+	}
+	if msg.To == "" && isGroupBroadcast(msg.Type) {
+		return h.handleGroupBroadcast(c, msg)
+	}
+	if msg.To == "" {
+		return nil, newFrameError(CodeInvalidMessage).withField("to")
+	}
+	allowed, err := h.allowedToSignal(c.UserID, msg.To, msg.GroupID)
+	if err != nil {
+		return nil, newFrameError(CodeAuthorizationFailed)
+	}
+	if !allowed {
+		return nil, newFrameError(CodeNotAllowed)
+	}
+	msg, forward, ferr := h.applyICEPolicy(c, msg)
+	if ferr != nil {
+		return nil, ferr
+	}
+	if !forward {
+		return filterResult{Filtered: true}, nil
+	}
+	msg.ID = ""
+	if ok := h.Hub.Send(msg.To, msg); !ok {
+		return nil, newFrameError(CodeTargetOffline)
+	}
+	return nil, nil
+}
+
+func frameScope(msgType string) string {
+	switch msgType {
+	case "", "presence.heartbeat":
+		return ""
+	case "presence.set":
+		return apikey.ScopePresenceWrite
+	case "presence.subscribe", "presence.unsubscribe":
+		return apikey.ScopePresenceRead
+	}
+	return apikey.ScopeSignalSend
+}
+
+func (c *Client) hasScope(scope string) bool {
+	if c.scopes == nil {
+		return true
+	}
+	for _, s := range c.scopes {
+		if s == scope {
+			return true
 		}
 	}
+	return false
 }
 
-func (c *Client) writeLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+func (c *Client) writeLoop(h *Handler) {
+	ticker := time.NewTicker(pingInterval)
 	defer func() {
 		ticker.Stop()
 		_ = c.Conn.Close()
 	}()
 	for {
 		select {
-		case msg, ok := <-c.Send:
-			if !ok {
-				_ = c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-c.out.notify:
+			if !c.flush(h) {
 				return
 			}
-			_ = c.Conn.WriteMessage(websocket.TextMessage, msg)
 		case <-ticker.C:
-			_ = c.Conn.WriteMessage(websocket.PingMessage, []byte("ping"))
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, []byte("ping")); err != nil {
+				writeErrors.Add(1)
+				return
+			}
+			h.checkIdle(c)
 		}
 	}
 }
+
+func (c *Client) flush(h *Handler) bool {
+	for {
+		if closed, code := c.out.state(); closed {
+			closeWith(c.Conn, code, closeReason(code))
+			return false
+		}
+		if oldest := c.out.oldest(); !oldest.IsZero() && time.Since(oldest) > h.StallTimeout {
+			slowConsumerCloses.Add(1)
+			closeWith(c.Conn, closeSlowConsumer, closeReason(closeSlowConsumer))
+			return false
+		}
+		data, ok := c.out.pop()
+		if !ok {
+			return true
+		}
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+		if err := c.Conn.WriteMessage(c.codec.MessageType(), data); err != nil {
+			writeErrors.Add(1)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				slowConsumerCloses.Add(1)
+			}
+			return false
+		}
+	}
+}
+
+func (c *Client) supports(feature string) bool {
+	_, ok := c.Features[feature]
+	return ok
+}
+
+func (c *Client) enqueue(msg SignalMessage) bool {
+	data, err := c.codec.Encode(msg)
+	if err != nil {
+		return false
+	}
+	p, key := classify(msg)
+	return c.out.push(p, key, data)
+}
+
+func (c *Client) reply(msg SignalMessage) {
+	c.enqueue(msg)
+}
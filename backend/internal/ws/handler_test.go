@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"testing"
+
+	"p2p-chat-app/backend/internal/apikey"
+)
+
+func TestDispatchEnforcesKeyScopes(t *testing.T) {
+	h := &Handler{}
+	cases := []struct {
+		msgType string
+		scopes  []string
+	}{
+		{"presence.set", []string{apikey.ScopePresenceRead, apikey.ScopeSignalSend}},
+		{"presence.subscribe", []string{apikey.ScopePresenceWrite, apikey.ScopeSignalSend}},
+		{"presence.unsubscribe", []string{apikey.ScopeSignalSend}},
+		{"signal.offer", []string{apikey.ScopePresenceRead, apikey.ScopePresenceWrite}},
+		{"group.call.start", []string{apikey.ScopePresenceRead}},
+		{"activity.typing", []string{}},
+	}
+	for _, tc := range cases {
+		c := testClient("alice", "s1")
+		c.scopes = tc.scopes
+		_, ferr := h.dispatch(c, SignalMessage{Type: tc.msgType})
+		if ferr == nil || ferr.Code != CodeInsufficientScope {
+			t.Errorf("%s with scopes %v: err = %v, want %s", tc.msgType, tc.scopes, ferr, CodeInsufficientScope)
+		}
+	}
+}
+
+func TestFrameScope(t *testing.T) {
+	cases := map[string]string{
+		"":                     "",
+		"presence.heartbeat":   "",
+		"presence.set":         apikey.ScopePresenceWrite,
+		"presence.subscribe":   apikey.ScopePresenceRead,
+		"presence.unsubscribe": apikey.ScopePresenceRead,
+		"signal.offer":         apikey.ScopeSignalSend,
+		"signal.ice":           apikey.ScopeSignalSend,
+		"activity.typing":      apikey.ScopeSignalSend,
+	}
+	for msgType, want := range cases {
+		if got := frameScope(msgType); got != want {
+			t.Errorf("frameScope(%q) = %q, want %q", msgType, got, want)
+		}
+	}
+}
+
+func TestClientHasScope(t *testing.T) {
+	user := testClient("alice", "s1")
+	if !user.hasScope(apikey.ScopeSignalSend) {
+		t.Error("user session was restricted by scope")
+	}
+	key := testClient("alice", "apikey:k1")
+	key.scopes = []string{apikey.ScopePresenceRead}
+	if !key.hasScope(apikey.ScopePresenceRead) || key.hasScope(apikey.ScopeSignalSend) {
+		t.Errorf("key scopes not enforced: %v", key.scopes)
+	}
+	key.scopes = []string{}
+	if key.hasScope(apikey.ScopePresenceRead) {
+		t.Error("empty scope list granted access")
+	}
+}
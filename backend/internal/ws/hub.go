@@ -1,49 +1,92 @@
 package ws
 
 import (
-	"encoding/json"
 	"log"
 	"sync"
+
+	"p2p-chat-app/backend/internal/session"
 )
 
 type Hub struct {
 	mu      sync.RWMutex
-	clients map[string]*Client
+	clients map[string]map[string]*Client
 }
 
 func NewHub() *Hub {
-	return &Hub{clients: make(map[string]*Client)}
+	return &Hub{clients: make(map[string]map[string]*Client)}
 }
 
 func (h *Hub) Register(c *Client) {
 	h.mu.Lock()
-	h.clients[c.UserID] = c
+	sessions, ok := h.clients[c.UserID]
+	if !ok {
+		sessions = make(map[string]*Client)
+		h.clients[c.UserID] = sessions
+	}
+	prev := sessions[c.AuthSessionID]
+	sessions[c.AuthSessionID] = c
 	h.mu.Unlock()
-	log.Printf("ws connected: %s", c.UserID)
+	if prev != nil {
+		prev.out.close(closeReplaced)
+		log.Printf("ws replaced: %s (%s)", c.UserID, c.AuthSessionID)
+	}
+	log.Printf("ws connected: %s (%s)", c.UserID, c.AuthSessionID)
 }
 
-func (h *Hub) Unregister(userID string) {
+func (h *Hub) Unregister(c *Client) bool {
 	h.mu.Lock()
-	delete(h.clients, userID)
+	sessions := h.clients[c.UserID]
+	last := false
+	if sessions[c.AuthSessionID] == c {
+		delete(sessions, c.AuthSessionID)
+		if len(sessions) == 0 {
+			delete(h.clients, c.UserID)
+			last = true
+		}
+	}
 	h.mu.Unlock()
-	log.Printf("ws disconnected: %s", userID)
+	log.Printf("ws disconnected: %s (%s)", c.UserID, c.AuthSessionID)
+	return last
 }
 
 func (h *Hub) Send(to string, msg SignalMessage) bool {
-	h.mu.RLock()
-	client, ok := h.clients[to]
-	h.mu.RUnlock()
-	if !ok {
-		return false
+	sent := false
+	for _, client := range h.sessionsOf(to) {
+		if f := requiredFeature(msg.Type); f != "" && !client.supports(f) {
+			continue
+		}
+		if client.enqueue(msg) {
+			sent = true
+		}
 	}
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return false
+	return sent
+}
+
+func (h *Hub) Supports(userID, feature string) bool {
+	for _, client := range h.sessionsOf(userID) {
+		if client.supports(feature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) Revoke(rev session.Revocation) {
+	for _, client := range h.sessionsOf(rev.UserID) {
+		if !rev.Matches(client.UserID, client.AuthSessionID) {
+			continue
+		}
+		client.out.close(closeSessionRevoked)
+		log.Printf("ws session revoked: %s (%s)", client.UserID, client.AuthSessionID)
 	}
-	select {
-	case client.Send <- data:
-		return true
-	default:
-		return false
+}
+
+func (h *Hub) sessionsOf(userID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for _, c := range h.clients[userID] {
+		clients = append(clients, c)
 	}
+	return clients
 }
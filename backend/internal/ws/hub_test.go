@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"testing"
+
+	"p2p-chat-app/backend/internal/session"
+)
+
+func testClient(userID, sessionID string) *Client {
+	return &Client{UserID: userID, AuthSessionID: sessionID, codec: jsonCodec{}, out: newOutQueue(8)}
+}
+
+func TestHubRegisterReplacesSameSession(t *testing.T) {
+	hub := NewHub()
+	first := testClient("alice", "s1")
+	second := testClient("alice", "s1")
+	hub.Register(first)
+	hub.Register(second)
+
+	if closed, code := first.out.state(); !closed || code != closeReplaced {
+		t.Errorf("replaced client state = %v, %d; want closed with %d", closed, code, closeReplaced)
+	}
+	if closed, _ := second.out.state(); closed {
+		t.Error("new client was closed")
+	}
+
+	if hub.Unregister(first) {
+		t.Error("unregistering the replaced client reported the user as gone")
+	}
+	if !hub.Send("alice", SignalMessage{Type: "signal.offer"}) {
+		t.Error("new client was removed when the replaced one unregistered")
+	}
+	if !hub.Unregister(second) {
+		t.Error("unregistering the last client did not report the user as gone")
+	}
+	if hub.Send("alice", SignalMessage{Type: "signal.offer"}) {
+		t.Error("send succeeded after the client unregistered")
+	}
+}
+
+func TestHubKeepsOneClientPerSession(t *testing.T) {
+	hub := NewHub()
+	phone := testClient("alice", "s1")
+	laptop := testClient("alice", "s2")
+	hub.Register(phone)
+	hub.Register(laptop)
+	for _, c := range []*Client{phone, laptop} {
+		if closed, _ := c.out.state(); closed {
+			t.Fatalf("client %s/%s closed by another session", c.UserID, c.AuthSessionID)
+		}
+	}
+
+	if !hub.Send("alice", SignalMessage{Type: "signal.offer"}) {
+		t.Fatal("send failed")
+	}
+	for _, c := range []*Client{phone, laptop} {
+		if _, ok := c.out.pop(); !ok {
+			t.Errorf("session %s did not receive the frame", c.AuthSessionID)
+		}
+	}
+
+	if hub.Unregister(phone) {
+		t.Error("user reported gone while another session is connected")
+	}
+	if !hub.Send("alice", SignalMessage{Type: "signal.offer"}) {
+		t.Error("remaining session unreachable")
+	}
+	if !hub.Unregister(laptop) {
+		t.Error("user not reported gone after the last session left")
+	}
+	phone.out.drain()
+	laptop.out.drain()
+}
+
+func TestHubRevokeMatchesSession(t *testing.T) {
+	hub := NewHub()
+	c := testClient("alice", "s1")
+	hub.Register(c)
+
+	hub.Revoke(session.Revocation{UserID: "alice", SessionID: "s2"})
+	if closed, _ := c.out.state(); closed {
+		t.Fatal("client closed by another session's revocation")
+	}
+	hub.Revoke(session.Revocation{UserID: "alice", Keep: "s1"})
+	if closed, _ := c.out.state(); closed {
+		t.Fatal("client closed by a revocation that keeps its session")
+	}
+	other := testClient("alice", "s2")
+	hub.Register(other)
+	hub.Revoke(session.Revocation{UserID: "alice", SessionID: "s1"})
+	if closed, code := c.out.state(); !closed || code != closeSessionRevoked {
+		t.Errorf("client state = %v, %d; want closed with %d", closed, code, closeSessionRevoked)
+	}
+	if closed, _ := other.out.state(); closed {
+		t.Error("revoking one session closed another")
+	}
+	hub.Revoke(session.Revocation{UserID: "alice"})
+	if closed, _ := other.out.state(); !closed {
+		t.Error("revoking every session left one open")
+	}
+}
+
+func TestHubKeepsEachAPIKeyConnected(t *testing.T) {
+	hub := NewHub()
+	keyA := testClient("svc", "apikey:k1")
+	keyB := testClient("svc", "apikey:k2")
+	hub.Register(keyA)
+	hub.Register(keyB)
+	if closed, _ := keyA.out.state(); closed {
+		t.Fatal("second api key disconnected the first")
+	}
+	hub.Revoke(session.Revocation{UserID: "svc", SessionID: "apikey:k2"})
+	if closed, _ := keyA.out.state(); closed {
+		t.Error("revoking one api key closed another")
+	}
+	if closed, _ := keyB.out.state(); !closed {
+		t.Error("revoked api key stayed connected")
+	}
+	keyA.out.drain()
+	keyB.out.drain()
+}
@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"p2p-chat-app/backend/internal/icepolicy"
+	"p2p-chat-app/backend/pkg/sdp"
+)
+
+type filterResult struct {
+	Filtered bool `json:"filtered"`
+}
+
+func (h *Handler) applyICEPolicy(c *Client, msg SignalMessage) (SignalMessage, bool, *FrameError) {
+	kind := signalKind(msg.Type)
+	if kind != "offer" && kind != "answer" && kind != "ice" {
+		return msg, true, nil
+	}
+	policy, err := h.ICEPolicies.Get(c.UserID)
+	if err != nil {
+		return msg, false, newFrameError(CodeInternal)
+	}
+	relayOnly := false
+	if msg.GroupID != "" && policy.RelayOnlyForNonFriends {
+		friends, err := h.Authz.AreFriends(c.UserID, msg.To)
+		if err != nil {
+			return msg, false, newFrameError(CodeAuthorizationFailed)
+		}
+		relayOnly = policy.RelayOnly(friends)
+	}
+	if policy == icepolicy.Default() && !relayOnly {
+		return msg, true, nil
+	}
+	return filterSignal(msg, kind, policy, relayOnly)
+}
+
+func filterSignal(msg SignalMessage, kind string, policy icepolicy.Policy, relayOnly bool) (SignalMessage, bool, *FrameError) {
+	filter := func(cand sdp.Candidate) (sdp.Candidate, bool) {
+		return policy.Filter(cand, relayOnly)
+	}
+	var payload interface{}
+	if kind == "ice" {
+		var p candidatePayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			return msg, false, invalidPayload("payload", "payload must be an object")
+		}
+		if *p.Candidate != "" {
+			cand, err := sdp.ParseCandidate(*p.Candidate)
+			if err != nil {
+				return msg, false, invalidPayload("payload.candidate", err.Error())
+			}
+			cand, keep := filter(cand)
+			if !keep {
+				return msg, false, nil
+			}
+			line := cand.String()
+			p.Candidate = &line
+		}
+		payload = p
+	} else {
+		var p descriptionPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			return msg, false, invalidPayload("payload", "payload must be an object")
+		}
+		rewritten := sdp.RewriteCandidates(*p.SDP, filter)
+		p.SDP = &rewritten
+		payload = p
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return msg, false, newFrameError(CodeInternal)
+	}
+	msg.Payload = data
+	return msg, true, nil
+}
+
+func (h *Handler) notifyICEPolicy(userID string, policy icepolicy.Policy) {
+	payload, _ := json.Marshal(policy)
+	h.Hub.Send(userID, SignalMessage{Type: "ice.policy", To: userID, Payload: payload})
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"p2p-chat-app/backend/internal/icepolicy"
+)
+
+const offerSDP = "v=0\r\n" +
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=group:BUNDLE 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0 network-id 1\r\n" +
+	"a=candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243 generation 0 network-id 1\r\n" +
+	"a=candidate:1853887674 1 tcp 1518280447 192.168.0.196 9 typ host tcptype active generation 0 network-id 1\r\n" +
+	"a=candidate:3745204734 1 udp 41885439 198.51.100.20 3478 typ relay raddr 203.0.113.7 rport 46243 generation 0 network-id 1\r\n" +
+	"a=ice-ufrag:EsAw\r\n" +
+	"a=ice-pwd:bP+XJMM09aR8AiX1jdukzR6Y\r\n" +
+	"a=mid:0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n"
+
+func offerMessage(t *testing.T) SignalMessage {
+	t.Helper()
+	payload, err := json.Marshal(map[string]string{"type": "offer", "sdp": offerSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignalMessage{Type: "signal.offer", To: "bob", Payload: payload}
+}
+
+func filteredSDP(t *testing.T, msg SignalMessage) string {
+	t.Helper()
+	var p descriptionPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type == nil || *p.Type != "offer" {
+		t.Fatalf("payload type lost: %s", msg.Payload)
+	}
+	return *p.SDP
+}
+
+func candidateTypes(body string) []string {
+	var types []string
+	for _, line := range strings.Split(body, "\r\n") {
+		if !strings.HasPrefix(line, "a=candidate:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		types = append(types, fields[7])
+	}
+	return types
+}
+
+func TestFilterSignalDescription(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    icepolicy.Policy
+		relayOnly bool
+		types     string
+		cleared   bool
+	}{
+		{"hide host", icepolicy.Policy{HideHost: true}, false, "srflx relay", true},
+		{"hide srflx", icepolicy.Policy{HideSrflx: true}, false, "host host relay", true},
+		{"hide both", icepolicy.Policy{HideHost: true, HideSrflx: true}, false, "relay", true},
+		{"relay only", icepolicy.Policy{RelayOnlyForNonFriends: true}, true, "relay", true},
+		{"relay only for friend", icepolicy.Policy{RelayOnlyForNonFriends: true}, false, "host srflx host relay", false},
+	}
+	for _, tc := range cases {
+		out, forward, ferr := filterSignal(offerMessage(t), "offer", tc.policy, tc.relayOnly)
+		if ferr != nil || !forward {
+			t.Fatalf("%s: forward=%v err=%v", tc.name, forward, ferr)
+		}
+		body := filteredSDP(t, out)
+		if got := strings.Join(candidateTypes(body), " "); got != tc.types {
+			t.Errorf("%s: candidate types = %q, want %q", tc.name, got, tc.types)
+		}
+		if tc.cleared && (strings.Contains(body, "raddr 192.168.0.196") || strings.Contains(body, "raddr 203.0.113.7")) {
+			t.Errorf("%s: related address leaked:\n%s", tc.name, body)
+		}
+		if !tc.cleared && body != offerSDP {
+			t.Errorf("%s: sdp changed:\n%s", tc.name, body)
+		}
+		if !strings.Contains(body, "a=ice-pwd:bP+XJMM09aR8AiX1jdukzR6Y\r\n") {
+			t.Errorf("%s: non-candidate lines were altered:\n%s", tc.name, body)
+		}
+	}
+}
+
+func TestFilterSignalCandidate(t *testing.T) {
+	ice := func(candidate string) SignalMessage {
+		payload, _ := json.Marshal(map[string]interface{}{"candidate": candidate, "sdpMid": "0"})
+		return SignalMessage{Type: "signal.ice", To: "bob", Payload: payload}
+	}
+	host := "candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0"
+	srflx := "candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243"
+
+	if _, forward, ferr := filterSignal(ice(host), "ice", icepolicy.Policy{HideHost: true}, false); ferr != nil || forward {
+		t.Errorf("hidden host candidate forwarded: forward=%v err=%v", forward, ferr)
+	}
+	if _, forward, ferr := filterSignal(ice(srflx), "ice", icepolicy.Policy{HideSrflx: true}, false); ferr != nil || forward {
+		t.Errorf("hidden srflx candidate forwarded: forward=%v err=%v", forward, ferr)
+	}
+	if _, forward, ferr := filterSignal(ice(srflx), "ice", icepolicy.Policy{RelayOnlyForNonFriends: true}, true); ferr != nil || forward {
+		t.Errorf("srflx candidate forwarded under relay only: forward=%v err=%v", forward, ferr)
+	}
+
+	out, forward, ferr := filterSignal(ice(srflx), "ice", icepolicy.Policy{HideHost: true}, false)
+	if ferr != nil || !forward {
+		t.Fatalf("srflx candidate dropped: forward=%v err=%v", forward, ferr)
+	}
+	var p candidatePayload
+	if err := json.Unmarshal(out.Payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	want := "candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 0.0.0.0 rport 0"
+	if *p.Candidate != want || p.SDPMid == nil || *p.SDPMid != "0" {
+		t.Errorf("candidate payload = %s, want candidate %q with sdpMid 0", out.Payload, want)
+	}
+
+	out, forward, ferr = filterSignal(ice(""), "ice", icepolicy.Policy{HideHost: true, HideSrflx: true}, true)
+	if ferr != nil || !forward {
+		t.Fatalf("end-of-candidates dropped: forward=%v err=%v", forward, ferr)
+	}
+	if err := json.Unmarshal(out.Payload, &p); err != nil || *p.Candidate != "" {
+		t.Errorf("end-of-candidates payload = %s", out.Payload)
+	}
+}
+
+func TestApplyICEPolicyIgnoresOtherSignals(t *testing.T) {
+	h := &Handler{}
+	msg := SignalMessage{Type: "signal.hangup", To: "bob", Payload: json.RawMessage(`{}`)}
+	out, forward, ferr := h.applyICEPolicy(&Client{UserID: "alice"}, msg)
+	if ferr != nil || !forward || string(out.Payload) != "{}" {
+		t.Errorf("applyICEPolicy(hangup) = %s, %v, %v", out.Payload, forward, ferr)
+	}
+}
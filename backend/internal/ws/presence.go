@@ -1,58 +1,100 @@
 package ws
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
+	"time"
+
+	"p2p-chat-app/backend/internal/presence"
 )
 
-type presencePayload struct {
-	UserID string `json:"userId"`
-	Status string `json:"status"`
+type presenceSetPayload struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
 }
 
-func (h *Handler) setPresence(userID, status string) {
-	_, err := h.DB.Exec(`
-		INSERT INTO presence (user_id, status, last_seen)
-		VALUES (?, ?, NOW())
-		ON DUPLICATE KEY UPDATE status = VALUES(status), last_seen = NOW()
-	`, userID, status)
+func (h *Handler) setPresence(userID string, update func(*presence.State) bool) {
+	_, _, err := h.Presence.Update(userID, func(s *presence.State) bool {
+		if !update(s) {
+			return false
+		}
+		s.Touch(time.Now())
+		return true
+	})
 	if err != nil {
 		log.Printf("presence update error: %v", err)
 	}
 }
 
-func (h *Handler) notifyFriendsPresence(userID, status string) {
-	friends, err := friendsOf(h.DB, userID)
+func (h *Handler) handlePresenceSet(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	var req presenceSetPayload
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, newFrameError(CodeInvalidPayload).withField("payload")
+	}
+	var updateErr error
+	h.setPresence(c.UserID, func(s *presence.State) bool {
+		updateErr = s.SetPreference(req.Status, req.Message)
+		return updateErr == nil
+	})
+	switch updateErr {
+	case nil:
+		return nil, nil
+	case presence.ErrMessageTooLong:
+		return nil, newFrameError(CodeInvalidPayload).withMessage(updateErr.Error()).withField("payload.message")
+	default:
+		return nil, newFrameError(CodeInvalidPayload).withMessage(updateErr.Error()).withField("payload.status")
+	}
+}
+
+func (h *Handler) markActive(c *Client) {
+	c.lastActive.Store(time.Now().UnixNano())
+	if c.idle.CompareAndSwap(true, false) {
+		h.setPresence(c.UserID, func(s *presence.State) bool { return s.SetIdle(false) })
+	}
+}
+
+func (h *Handler) checkIdle(c *Client) {
+	last := time.Unix(0, c.lastActive.Load())
+	if time.Since(last) < h.IdleAfter {
+		return
+	}
+	if c.idle.CompareAndSwap(false, true) {
+		h.setPresence(c.UserID, func(s *presence.State) bool { return s.SetIdle(true) })
+	}
+}
+
+func (h *Handler) NotifyPresence(state presence.State) {
+	audience, err := h.presenceAudience(state.UserID)
 	if err != nil {
 		log.Printf("presence notify error: %v", err)
 		return
 	}
-	payload, _ := json.Marshal(presencePayload{UserID: userID, Status: status})
+	privacy, err := h.Presence.Privacy(state.UserID)
+	if err != nil {
+		log.Printf("presence privacy error: %v", err)
+		return
+	}
+	view := state.View()
 	msg := SignalMessage{
-		Type:    "presence.update",
-		From:    userID,
-		Payload: payload,
+		Type: "presence.update",
+		From: state.UserID,
 	}
-	for _, friendID := range friends {
-		msg.To = friendID
-		h.Hub.Send(friendID, msg)
+	for id, rel := range audience {
+		v := privacy.Apply(view, id, rel)
+		if !h.Hub.Supports(id, featurePresenceRich) {
+			v = basicView(v)
+		}
+		msg.To = id
+		msg.Payload, _ = json.Marshal(v)
+		h.Hub.Send(id, msg)
 	}
 }
 
-func friendsOf(db *sql.DB, userID string) ([]string, error) {
-	rows, err := db.Query(`SELECT friend_user_id FROM friends WHERE user_id = ?`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	ids := make([]string, 0)
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			return nil, err
-		}
-		ids = append(ids, id)
+func basicView(v presence.View) presence.View {
+	if v.Status != presence.StatusOffline {
+		v.Status = presence.StatusOnline
 	}
-	return ids, nil
+	v.Message = ""
+	v.Idle = false
+	return v
 }
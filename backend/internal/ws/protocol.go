@@ -0,0 +1,156 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"p2p-chat-app/backend/internal/icepolicy"
+)
+
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 2
+
+	handshakeTimeout = 10 * time.Second
+	pingInterval     = 30 * time.Second
+
+	closeHandshakeRequired  = 4000
+	closeUnsupportedVersion = 4001
+	closeSessionRevoked     = 4003
+	closeReplaced           = 4009
+)
+
+const (
+	featureActivity          = "activity"
+	featureGroupBroadcast    = "group.broadcast"
+	featurePresenceRich      = "presence.rich"
+	featurePresenceSubscribe = "presence.subscribe"
+	featureICEPolicy         = "ice.policy"
+)
+
+var serverFeatures = []string{
+	featureActivity,
+	featureGroupBroadcast,
+	featurePresenceRich,
+	featurePresenceSubscribe,
+	featureICEPolicy,
+}
+
+type helloPayload struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+}
+
+type welcomePayload struct {
+	Version           int              `json:"version"`
+	SessionID         string           `json:"sessionId"`
+	HeartbeatInterval int64            `json:"heartbeatInterval"`
+	IdleAfter         int64            `json:"idleAfter"`
+	Features          []string         `json:"features"`
+	Encoding          string           `json:"encoding"`
+	Compression       bool             `json:"compression"`
+	ICEPolicy         icepolicy.Policy `json:"icePolicy"`
+}
+
+func (h *Handler) handshake(conn *websocket.Conn, cd codec, compressed bool, policy icepolicy.Policy) (string, map[string]struct{}, bool) {
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var msg SignalMessage
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		err = cd.Decode(data, &msg)
+	}
+	if err != nil || msg.Type != "hello" {
+		closeWith(conn, closeHandshakeRequired, "hello required")
+		return "", nil, false
+	}
+	var hello helloPayload
+	if err := json.Unmarshal(msg.Payload, &hello); err != nil {
+		closeWith(conn, closeHandshakeRequired, "invalid hello")
+		return "", nil, false
+	}
+	if hello.Version < MinProtocolVersion || hello.Version > ProtocolVersion {
+		closeWith(conn, closeUnsupportedVersion,
+			fmt.Sprintf("unsupported protocol version %d, server supports %d-%d", hello.Version, MinProtocolVersion, ProtocolVersion))
+		return "", nil, false
+	}
+
+	features := negotiateFeatures(hello.Features)
+	enabled := make([]string, 0, len(features))
+	for _, f := range serverFeatures {
+		if _, ok := features[f]; ok {
+			enabled = append(enabled, f)
+		}
+	}
+	sessionID := uuid.NewString()
+	payload, _ := json.Marshal(welcomePayload{
+		Version:           ProtocolVersion,
+		SessionID:         sessionID,
+		HeartbeatInterval: pingInterval.Milliseconds(),
+		IdleAfter:         h.IdleAfter.Milliseconds(),
+		Features:          enabled,
+		Encoding:          cd.Name(),
+		Compression:       compressed,
+		ICEPolicy:         policy,
+	})
+	welcome, err := cd.Encode(SignalMessage{Type: "welcome", Payload: payload})
+	if err == nil {
+		err = conn.WriteMessage(cd.MessageType(), welcome)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return "", nil, false
+	}
+	return sessionID, features, true
+}
+
+func negotiateFeatures(requested []string) map[string]struct{} {
+	features := make(map[string]struct{})
+	for _, f := range requested {
+		for _, supported := range serverFeatures {
+			if strings.EqualFold(f, supported) {
+				features[supported] = struct{}{}
+			}
+		}
+	}
+	return features
+}
+
+func requiredFeature(msgType string) string {
+	switch {
+	case strings.HasPrefix(msgType, "activity."):
+		return featureActivity
+	case msgType == "delivery.report":
+		return featureGroupBroadcast
+	case msgType == "presence.snapshot":
+		return featurePresenceSubscribe
+	case msgType == "ice.policy":
+		return featureICEPolicy
+	default:
+		return ""
+	}
+}
+
+func closeWith(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	_ = conn.Close()
+}
+
+func closeReason(code int) string {
+	switch code {
+	case closeSlowConsumer:
+		return "slow consumer"
+	case closeRateLimited:
+		return "rate limit exceeded"
+	case closeSessionRevoked:
+		return "session revoked"
+	case closeReplaced:
+		return "replaced by a newer connection"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+)
+
+const closeSlowConsumer = 4008
+
+type priority int
+
+const (
+	prioritySignal priority = iota
+	priorityPresence
+	priorityActivity
+)
+
+const (
+	maxActivityQueue = 16
+	signalHardFactor = 4
+)
+
+var (
+	queueDepth          = expvar.NewInt("ws_queue_depth")
+	queueDropped        = expvar.NewMap("ws_queue_dropped")
+	queueCoalesced      = expvar.NewInt("ws_queue_coalesced")
+	slowConsumerCloses  = expvar.NewInt("ws_slow_consumer_disconnects")
+	writeErrors         = expvar.NewInt("ws_write_errors")
+	maxClientQueueDepth = expvar.NewInt("ws_queue_depth_max")
+)
+
+type queuedFrame struct {
+	data     []byte
+	queuedAt time.Time
+}
+
+type outQueue struct {
+	mu        sync.Mutex
+	signal    []queuedFrame
+	presence  map[string]queuedFrame
+	order     []string
+	activity  []queuedFrame
+	maxSignal int
+	notify    chan struct{}
+	closed    bool
+	closeCode int
+}
+
+func newOutQueue(maxSignal int) *outQueue {
+	return &outQueue{
+		presence:  make(map[string]queuedFrame),
+		maxSignal: maxSignal,
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+func classify(msg SignalMessage) (priority, string) {
+	switch {
+	case msg.Type == "presence.update":
+		return priorityPresence, msg.From
+	case strings.HasPrefix(msg.Type, "activity."):
+		return priorityActivity, ""
+	default:
+		return prioritySignal, ""
+	}
+}
+
+func (q *outQueue) push(p priority, key string, data []byte) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	frame := queuedFrame{data: data, queuedAt: time.Now()}
+	switch p {
+	case prioritySignal:
+		if len(q.signal) >= q.maxSignal*signalHardFactor {
+			q.closed = true
+			q.closeCode = closeSlowConsumer
+			q.mu.Unlock()
+			slowConsumerCloses.Add(1)
+			q.wake()
+			return false
+		}
+		q.signal = append(q.signal, frame)
+		queueDepth.Add(1)
+	case priorityPresence:
+		if _, ok := q.presence[key]; ok {
+			queueCoalesced.Add(1)
+		} else {
+			q.order = append(q.order, key)
+			queueDepth.Add(1)
+		}
+		q.presence[key] = frame
+	case priorityActivity:
+		if len(q.activity) >= maxActivityQueue {
+			q.activity = q.activity[1:]
+			queueDropped.Add("activity", 1)
+			queueDepth.Add(-1)
+		}
+		q.activity = append(q.activity, frame)
+		queueDepth.Add(1)
+	}
+	if depth := int64(q.depthLocked()); depth > maxClientQueueDepth.Value() {
+		maxClientQueueDepth.Set(depth)
+	}
+	q.mu.Unlock()
+	q.wake()
+	return true
+}
+
+func (q *outQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case len(q.signal) > 0:
+		frame := q.signal[0]
+		q.signal = q.signal[1:]
+		queueDepth.Add(-1)
+		return frame.data, true
+	case len(q.order) > 0:
+		key := q.order[0]
+		q.order = q.order[1:]
+		frame := q.presence[key]
+		delete(q.presence, key)
+		queueDepth.Add(-1)
+		return frame.data, true
+	case len(q.activity) > 0:
+		frame := q.activity[0]
+		q.activity = q.activity[1:]
+		queueDepth.Add(-1)
+		return frame.data, true
+	}
+	return nil, false
+}
+
+func (q *outQueue) oldest() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.signal) > 0 {
+		return q.signal[0].queuedAt
+	}
+	if len(q.order) > 0 {
+		return q.presence[q.order[0]].queuedAt
+	}
+	return time.Time{}
+}
+
+func (q *outQueue) close(code int) {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.closeCode = code
+	}
+	q.mu.Unlock()
+	q.wake()
+}
+
+func (q *outQueue) state() (bool, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed, q.closeCode
+}
+
+func (q *outQueue) drain() {
+	q.mu.Lock()
+	depth := q.depthLocked()
+	q.signal = nil
+	q.presence = make(map[string]queuedFrame)
+	q.order = nil
+	q.activity = nil
+	q.mu.Unlock()
+	queueDepth.Add(-int64(depth))
+}
+
+func (q *outQueue) depthLocked() int {
+	return len(q.signal) + len(q.order) + len(q.activity)
+}
+
+func (q *outQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
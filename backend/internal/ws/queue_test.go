@@ -0,0 +1,41 @@
+package ws
+
+import "testing"
+
+func TestSignalQueueAbsorbsBursts(t *testing.T) {
+	q := newOutQueue(4)
+	for i := 0; i < 4*signalHardFactor; i++ {
+		if !q.push(prioritySignal, "", []byte{byte(i)}) {
+			t.Fatalf("push %d rejected below the hard cap", i)
+		}
+	}
+	if closed, _ := q.state(); closed {
+		t.Fatal("queue closed below the hard cap")
+	}
+	if q.push(prioritySignal, "", []byte{0}) {
+		t.Fatal("push accepted past the hard cap")
+	}
+	if closed, code := q.state(); !closed || code != closeSlowConsumer {
+		t.Errorf("state = %v, %d; want closed with %d", closed, code, closeSlowConsumer)
+	}
+	q.drain()
+}
+
+func TestQueuePopOrder(t *testing.T) {
+	q := newOutQueue(4)
+	q.push(priorityActivity, "", []byte("a"))
+	q.push(priorityPresence, "bob", []byte("p1"))
+	q.push(priorityPresence, "bob", []byte("p2"))
+	q.push(prioritySignal, "", []byte("s"))
+	var got []string
+	for {
+		data, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, string(data))
+	}
+	if want := []string{"s", "p2", "a"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
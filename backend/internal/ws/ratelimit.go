@@ -0,0 +1,210 @@
+package ws
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	closeRateLimited = 4029
+
+	strikeDecay      = time.Minute
+	maxThrottleDelay = 10 * time.Second
+)
+
+const DefaultTypeLimits = "sdp=2:10,ice=20:60,presence=1:10,activity=2:6,call=1:5,other=5:10"
+
+type penalty int
+
+const (
+	penaltyNone penalty = iota
+	penaltyWarn
+	penaltyThrottle
+	penaltyDisconnect
+)
+
+var rateLimited = expvar.NewMap("ws_rate_limited")
+
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+func ParseRateLimits(spec string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		class, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q", entry)
+		}
+		rps, burst, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q", entry)
+		}
+		r, err := strconv.ParseFloat(rps, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("invalid rate for %q", class)
+		}
+		b, err := strconv.Atoi(burst)
+		if err != nil || b < 1 {
+			return nil, fmt.Errorf("invalid burst for %q", class)
+		}
+		limits[strings.TrimSpace(class)] = RateLimit{RPS: r, Burst: b}
+	}
+	return limits, nil
+}
+
+func mustParseRateLimits(spec string) map[string]RateLimit {
+	limits, err := ParseRateLimits(spec)
+	if err != nil {
+		panic(err)
+	}
+	return limits
+}
+
+func limitClass(msgType string) string {
+	switch {
+	case strings.HasSuffix(msgType, "signal.offer"), strings.HasSuffix(msgType, "signal.answer"):
+		return "sdp"
+	case strings.HasSuffix(msgType, "signal.ice"):
+		return "ice"
+	case strings.HasPrefix(msgType, "presence."):
+		return "presence"
+	case strings.HasPrefix(msgType, "activity."):
+		return "activity"
+	case strings.HasPrefix(msgType, "group.call."):
+		return "call"
+	default:
+		return "other"
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	if b.last.IsZero() {
+		b.tokens = float64(limit.Burst)
+	} else {
+		b.tokens = minFloat(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.RPS)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.RPS * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+type userLimits struct {
+	buckets    map[string]*bucket
+	strikes    int
+	lastStrike time.Time
+	lastSeen   time.Time
+}
+
+type rateLimiter struct {
+	mu    sync.Mutex
+	users map[string]*userLimits
+}
+
+func newRateLimiter() *rateLimiter {
+	rl := &rateLimiter{users: make(map[string]*userLimits)}
+	go rl.cleanupLoop()
+	return rl
+}
+
+func (rl *rateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		rl.mu.Lock()
+		for id, u := range rl.users {
+			if time.Since(u.lastSeen) > 10*time.Minute {
+				delete(rl.users, id)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+func (h *Handler) checkRate(userID, msgType string) (penalty, int, time.Duration) {
+	class := limitClass(msgType)
+	now := time.Now()
+
+	h.limiter.mu.Lock()
+	defer h.limiter.mu.Unlock()
+	u, ok := h.limiter.users[userID]
+	if !ok {
+		u = &userLimits{buckets: make(map[string]*bucket)}
+		h.limiter.users[userID] = u
+	}
+	u.lastSeen = now
+	if u.strikes > 0 && now.Sub(u.lastStrike) > strikeDecay {
+		u.strikes = 0
+	}
+
+	allowed, wait := u.bucket(class).take(h.limitFor(class), now)
+	if allowed {
+		allowed, wait = u.bucket("*").take(h.RateLimit, now)
+	}
+	if allowed {
+		return penaltyNone, 0, 0
+	}
+
+	u.strikes++
+	u.lastStrike = now
+	switch {
+	case u.strikes >= h.DisconnectAfter:
+		rateLimited.Add("disconnect", 1)
+		return penaltyDisconnect, u.strikes, wait
+	case u.strikes >= h.ThrottleAfter:
+		rateLimited.Add("throttle", 1)
+		return penaltyThrottle, u.strikes, wait
+	default:
+		rateLimited.Add("warn", 1)
+		return penaltyWarn, u.strikes, wait
+	}
+}
+
+func (h *Handler) limitFor(class string) RateLimit {
+	if limit, ok := h.TypeLimits[class]; ok {
+		return limit
+	}
+	return h.RateLimit
+}
+
+func (h *Handler) throttleDelay(strikes int) time.Duration {
+	delay := h.ThrottleDelay * time.Duration(strikes-h.ThrottleAfter+1)
+	if delay > maxThrottleDelay {
+		return maxThrottleDelay
+	}
+	return delay
+}
+
+func (u *userLimits) bucket(class string) *bucket {
+	b, ok := u.buckets[class]
+	if !ok {
+		b = &bucket{}
+		u.buckets[class] = b
+	}
+	return b
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,23 @@
+package ws
+
+import "testing"
+
+func TestDefaultTypeLimitsCoverEveryClass(t *testing.T) {
+	limits, err := ParseRateLimits(DefaultTypeLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msgType := range []string{"signal.offer", "group.signal.ice", "presence.set", "activity.typing", "group.call.start", "chat.busy"} {
+		if _, ok := limits[limitClass(msgType)]; !ok {
+			t.Errorf("no default limit for %s (class %s)", msgType, limitClass(msgType))
+		}
+	}
+}
+
+func TestParseRateLimitsRejects(t *testing.T) {
+	for _, spec := range []string{"sdp", "sdp=2", "sdp=0:10", "sdp=x:10", "sdp=2:0", "sdp=2:x"} {
+		if _, err := ParseRateLimits(spec); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded, want error", spec)
+		}
+	}
+}
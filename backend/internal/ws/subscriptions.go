@@ -0,0 +1,322 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"p2p-chat-app/backend/internal/presence"
+)
+
+const (
+	maxUserSubscriptions  = 200
+	maxGroupSubscriptions = 50
+)
+
+type presenceSubscribePayload struct {
+	UserIDs  []string `json:"userIds"`
+	GroupIDs []string `json:"groupIds"`
+}
+
+type subscribeResult struct {
+	Rejected []rejection `json:"rejected"`
+}
+
+type subscriberEntry struct {
+	users  map[string]presence.Relation
+	groups map[string]struct{}
+}
+
+type subscriptions struct {
+	mu          sync.RWMutex
+	byUser      map[string]map[string]presence.Relation
+	byGroup     map[string]map[string]struct{}
+	subscribers map[string]*subscriberEntry
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		byUser:      make(map[string]map[string]presence.Relation),
+		byGroup:     make(map[string]map[string]struct{}),
+		subscribers: make(map[string]*subscriberEntry),
+	}
+}
+
+func (s *subscriptions) entry(subscriber string) *subscriberEntry {
+	e, ok := s.subscribers[subscriber]
+	if !ok {
+		e = &subscriberEntry{
+			users:  make(map[string]presence.Relation),
+			groups: make(map[string]struct{}),
+		}
+		s.subscribers[subscriber] = e
+	}
+	return e
+}
+
+func (s *subscriptions) addUser(subscriber, target string, rel presence.Relation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(subscriber)
+	if _, ok := e.users[target]; !ok && len(e.users) >= maxUserSubscriptions {
+		return false
+	}
+	e.users[target] = rel
+	if s.byUser[target] == nil {
+		s.byUser[target] = make(map[string]presence.Relation)
+	}
+	s.byUser[target][subscriber] = rel
+	return true
+}
+
+func (s *subscriptions) addGroup(subscriber, groupID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(subscriber)
+	if _, ok := e.groups[groupID]; !ok && len(e.groups) >= maxGroupSubscriptions {
+		return false
+	}
+	e.groups[groupID] = struct{}{}
+	if s.byGroup[groupID] == nil {
+		s.byGroup[groupID] = make(map[string]struct{})
+	}
+	s.byGroup[groupID][subscriber] = struct{}{}
+	return true
+}
+
+func (s *subscriptions) removeUser(subscriber, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.subscribers[subscriber]; ok {
+		delete(e.users, target)
+	}
+	if subs, ok := s.byUser[target]; ok {
+		delete(subs, subscriber)
+		if len(subs) == 0 {
+			delete(s.byUser, target)
+		}
+	}
+}
+
+func (s *subscriptions) removeGroup(subscriber, groupID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.subscribers[subscriber]; ok {
+		delete(e.groups, groupID)
+	}
+	if subs, ok := s.byGroup[groupID]; ok {
+		delete(subs, subscriber)
+		if len(subs) == 0 {
+			delete(s.byGroup, groupID)
+		}
+	}
+}
+
+func (s *subscriptions) clear(subscriber string) {
+	s.mu.RLock()
+	e, ok := s.subscribers[subscriber]
+	var users, groups []string
+	if ok {
+		for id := range e.users {
+			users = append(users, id)
+		}
+		for id := range e.groups {
+			groups = append(groups, id)
+		}
+	}
+	s.mu.RUnlock()
+	for _, id := range users {
+		s.removeUser(subscriber, id)
+	}
+	for _, id := range groups {
+		s.removeGroup(subscriber, id)
+	}
+	s.mu.Lock()
+	delete(s.subscribers, subscriber)
+	s.mu.Unlock()
+}
+
+func (s *subscriptions) hasGroups() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.byGroup) > 0
+}
+
+func (s *subscriptions) userSubscribers(target string) map[string]presence.Relation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]presence.Relation, len(s.byUser[target]))
+	for id, rel := range s.byUser[target] {
+		out[id] = rel
+	}
+	return out
+}
+
+func (s *subscriptions) groupSubscribers(groupID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.byGroup[groupID]))
+	for id := range s.byGroup[groupID] {
+		out = append(out, id)
+	}
+	return out
+}
+
+func (h *Handler) handlePresenceSubscribe(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	var req presenceSubscribePayload
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, newFrameError(CodeInvalidPayload).withField("payload")
+	}
+
+	result := subscribeResult{Rejected: make([]rejection, 0)}
+	targets := make(map[string]presence.Relation)
+	for _, groupID := range req.GroupIDs {
+		members, err := h.groupRecipients(groupID, c.UserID)
+		if err == errNotGroupMember {
+			result.Rejected = append(result.Rejected, rejection{ID: groupID, Code: CodeNotAllowed})
+			continue
+		}
+		if err != nil {
+			result.Rejected = append(result.Rejected, rejection{ID: groupID, Code: CodeAuthorizationFailed})
+			continue
+		}
+		if !h.subs.addGroup(c.UserID, groupID) {
+			result.Rejected = append(result.Rejected, rejection{ID: groupID, Code: CodeTooManySubscriptions})
+			continue
+		}
+		for _, id := range members {
+			if _, ok := targets[id]; !ok {
+				targets[id] = presence.RelationGroup
+			}
+		}
+	}
+	for _, target := range req.UserIDs {
+		if target == c.UserID {
+			continue
+		}
+		rel, err := h.relation(c.UserID, target)
+		if err != nil {
+			result.Rejected = append(result.Rejected, rejection{ID: target, Code: CodeAuthorizationFailed})
+			continue
+		}
+		if rel == presence.RelationOther {
+			result.Rejected = append(result.Rejected, rejection{ID: target, Code: CodeNotAllowed})
+			continue
+		}
+		if !h.subs.addUser(c.UserID, target, rel) {
+			result.Rejected = append(result.Rejected, rejection{ID: target, Code: CodeTooManySubscriptions})
+			continue
+		}
+		if rel > targets[target] {
+			targets[target] = rel
+		}
+	}
+	if len(req.GroupIDs) > 0 {
+		friends, err := h.Authz.FriendsOf(c.UserID)
+		if err != nil {
+			return nil, newFrameError(CodeInternal)
+		}
+		for _, id := range friends {
+			if _, ok := targets[id]; ok {
+				targets[id] = presence.RelationFriend
+			}
+		}
+	}
+	h.sendPresenceSnapshot(c.UserID, targets)
+	if msg.ID == "" && len(result.Rejected) > 0 {
+		payload, _ := json.Marshal(result)
+		c.reply(SignalMessage{Type: "presence.subscribe.result", Payload: payload})
+	}
+	return result, nil
+}
+
+func (h *Handler) handlePresenceUnsubscribe(c *Client, msg SignalMessage) (interface{}, *FrameError) {
+	var req presenceSubscribePayload
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, newFrameError(CodeInvalidPayload).withField("payload")
+	}
+	for _, groupID := range req.GroupIDs {
+		h.subs.removeGroup(c.UserID, groupID)
+	}
+	for _, target := range req.UserIDs {
+		h.subs.removeUser(c.UserID, target)
+	}
+	return nil, nil
+}
+
+func (h *Handler) sendPresenceSnapshot(subscriber string, targets map[string]presence.Relation) {
+	if len(targets) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+	states, err := h.Presence.GetMany(ids)
+	if err != nil {
+		log.Printf("presence snapshot error: %v", err)
+		return
+	}
+	privacies, err := h.Presence.Privacies(ids)
+	if err != nil {
+		log.Printf("presence snapshot error: %v", err)
+		return
+	}
+	views := make([]presence.View, 0, len(ids))
+	for _, id := range ids {
+		views = append(views, privacies[id].Apply(states[id].View(), subscriber, targets[id]))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"presence": views})
+	h.Hub.Send(subscriber, SignalMessage{
+		Type:    "presence.snapshot",
+		To:      subscriber,
+		Payload: payload,
+	})
+}
+
+func (h *Handler) presenceAudience(userID string) (map[string]presence.Relation, error) {
+	audience := make(map[string]presence.Relation)
+	friends, err := h.Authz.FriendsOf(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range friends {
+		audience[id] = presence.RelationFriend
+	}
+	if h.subs.hasGroups() {
+		groups, err := h.Authz.GroupsOf(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, groupID := range groups {
+			for _, id := range h.subs.groupSubscribers(groupID) {
+				member, err := h.Authz.IsMember(groupID, id)
+				if err != nil {
+					return nil, err
+				}
+				if !member {
+					h.subs.removeGroup(id, groupID)
+					continue
+				}
+				if _, ok := audience[id]; !ok {
+					audience[id] = presence.RelationGroup
+				}
+			}
+		}
+	}
+	for id := range h.subs.userSubscribers(userID) {
+		rel, err := h.relation(id, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rel == presence.RelationOther {
+			h.subs.removeUser(id, userID)
+			continue
+		}
+		if rel > audience[id] {
+			audience[id] = rel
+		}
+	}
+	delete(audience, userID)
+	return audience, nil
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ticketTTL = 30 * time.Second
+
+type ticketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func (h *Handler) IssueTicket(c *gin.Context) {
+	userID := c.GetString("userId")
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue ticket"})
+		return
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(ticketTTL)
+
+	if _, err := h.DB.Exec(`DELETE FROM ws_tickets WHERE expires_at < ?`, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	_, err := h.DB.Exec(`
+		INSERT INTO ws_tickets (ticket_hash, user_id, session_id, client_ip, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hashTicket(ticket), userID, c.GetString("sessionId"), c.ClientIP(), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusCreated, ticketResponse{Ticket: ticket, ExpiresAt: expiresAt.UnixMilli()})
+}
+
+func redeemTicket(db *sql.DB, ticket, clientIP string) (string, string, bool, error) {
+	hash := hashTicket(ticket)
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", false, err
+	}
+	defer tx.Rollback()
+
+	var userID, sessionID, boundIP string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT user_id, session_id, client_ip, expires_at
+		FROM ws_tickets
+		WHERE ticket_hash = ?
+		FOR UPDATE
+	`, hash).Scan(&userID, &sessionID, &boundIP, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM ws_tickets WHERE ticket_hash = ?`, hash); err != nil {
+		return "", "", false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", false, err
+	}
+	if time.Now().After(expiresAt) || boundIP != clientIP {
+		return "", "", false, nil
+	}
+	return userID, sessionID, true, nil
+}
+
+func hashTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
@@ -8,6 +8,23 @@ var allowedSignalTypes = map[string]struct{}{
 	"group.signal.offer":  {},
 	"group.signal.answer": {},
 	"group.signal.ice":    {},
+	"group.call.start":    {},
+	"group.call.join":     {},
+	"group.call.leave":    {},
+	"group.call.end":      {},
+}
+
+var groupBroadcastTypes = map[string]struct{}{
+	"group.call.start": {},
+	"group.call.join":  {},
+	"group.call.leave": {},
+	"group.call.end":   {},
+}
+
+var activityTypes = map[string]string{
+	"activity.typing":    "typing",
+	"activity.recording": "recording",
+	"activity.stop":      "",
 }
 
 func isAllowedSignalType(t string) bool {
@@ -17,9 +34,20 @@ func isAllowedSignalType(t string) bool {
 
 func isGroupSignal(t string) bool {
 	switch t {
-	case "group.signal.offer", "group.signal.answer", "group.signal.ice":
+	case "group.signal.offer", "group.signal.answer", "group.signal.ice",
+		"group.call.start", "group.call.join", "group.call.leave", "group.call.end":
 		return true
 	default:
 		return false
 	}
 }
+
+func isGroupBroadcast(t string) bool {
+	_, ok := groupBroadcastTypes[t]
+	return ok
+}
+
+func isActivity(t string) bool {
+	_, ok := activityTypes[t]
+	return ok
+}
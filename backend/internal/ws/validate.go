@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"encoding/json"
+	"strings"
+
+	"p2p-chat-app/backend/pkg/sdp"
+)
+
+const (
+	maxCandidateLength = 1024
+	maxSdpMidLength    = 64
+	maxUfragLength     = 256
+	maxControlPayload  = 4096
+)
+
+type descriptionPayload struct {
+	Type *string `json:"type"`
+	SDP  *string `json:"sdp"`
+}
+
+type candidatePayload struct {
+	Candidate        *string `json:"candidate"`
+	SDPMid           *string `json:"sdpMid"`
+	SDPMLineIndex    *int    `json:"sdpMLineIndex"`
+	UsernameFragment *string `json:"usernameFragment"`
+}
+
+func (h *Handler) validatePayload(msg SignalMessage) *FrameError {
+	switch signalKind(msg.Type) {
+	case "offer", "answer":
+		return h.validateDescription(msg.Payload, signalKind(msg.Type))
+	case "ice":
+		return validateCandidate(msg.Payload)
+	}
+	if len(msg.Payload) > maxControlPayload {
+		return invalidPayload("payload", "payload too large")
+	}
+	return nil
+}
+
+func (h *Handler) validateDescription(raw json.RawMessage, kind string) *FrameError {
+	var p descriptionPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("payload", "payload must be an object")
+	}
+	if p.Type == nil || *p.Type != kind {
+		return invalidPayload("payload.type", "type must be "+kind)
+	}
+	if p.SDP == nil {
+		return invalidPayload("payload.sdp", "sdp is required")
+	}
+	if err := sdp.Validate(*p.SDP, h.MaxSDPSize); err != nil {
+		return invalidPayload("payload.sdp", err.Error())
+	}
+	return nil
+}
+
+func validateCandidate(raw json.RawMessage) *FrameError {
+	var p candidatePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("payload", "payload must be an object")
+	}
+	if p.Candidate == nil {
+		return invalidPayload("payload.candidate", "candidate is required")
+	}
+	if len(*p.Candidate) > maxCandidateLength {
+		return invalidPayload("payload.candidate", "candidate too long")
+	}
+	if p.SDPMid != nil && len(*p.SDPMid) > maxSdpMidLength {
+		return invalidPayload("payload.sdpMid", "sdpMid too long")
+	}
+	if p.SDPMLineIndex != nil && (*p.SDPMLineIndex < 0 || *p.SDPMLineIndex > 1024) {
+		return invalidPayload("payload.sdpMLineIndex", "sdpMLineIndex out of range")
+	}
+	if p.UsernameFragment != nil && len(*p.UsernameFragment) > maxUfragLength {
+		return invalidPayload("payload.usernameFragment", "usernameFragment too long")
+	}
+	if *p.Candidate == "" {
+		return nil
+	}
+	if p.SDPMid == nil && p.SDPMLineIndex == nil {
+		return invalidPayload("payload.sdpMid", "sdpMid or sdpMLineIndex is required")
+	}
+	if _, err := sdp.ParseCandidate(*p.Candidate); err != nil {
+		return invalidPayload("payload.candidate", err.Error())
+	}
+	return nil
+}
+
+func signalKind(msgType string) string {
+	switch {
+	case strings.HasPrefix(msgType, "signal."):
+		return strings.TrimPrefix(msgType, "signal.")
+	case strings.HasPrefix(msgType, "group.signal."):
+		return strings.TrimPrefix(msgType, "group.signal.")
+	default:
+		return ""
+	}
+}
+
+func invalidPayload(field, message string) *FrameError {
+	return newFrameError(CodeInvalidPayload).withField(field).withMessage(message)
+}
@@ -0,0 +1,4 @@
+ALTER TABLE presence
+  ADD COLUMN preferred_status VARCHAR(16) NOT NULL DEFAULT 'online' AFTER status,
+  ADD COLUMN custom_message VARCHAR(140) NOT NULL DEFAULT '' AFTER preferred_status,
+  ADD COLUMN idle TINYINT(1) NOT NULL DEFAULT 0 AFTER custom_message;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS presence_privacy (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL UNIQUE,
+  last_seen_visibility VARCHAR(16) NOT NULL DEFAULT 'everyone',
+  hide_from_groups TINYINT(1) NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS presence_hidden_from (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  hidden_from_user_id VARCHAR(36) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_presence_hidden (user_id, hidden_from_user_id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS cluster_events (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  node_id VARCHAR(64) NOT NULL,
+  topic VARCHAR(64) NOT NULL,
+  data JSON NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_cluster_events_created (created_at)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS presence_nodes (
+  node_id VARCHAR(64) PRIMARY KEY,
+  started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  heartbeat_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE presence
+  ADD COLUMN node_id VARCHAR(64) NULL AFTER idle,
+  ADD KEY idx_presence_node (node_id, status);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS ice_policies (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL UNIQUE,
+  hide_host TINYINT(1) NOT NULL DEFAULT 0,
+  hide_srflx TINYINT(1) NOT NULL DEFAULT 0,
+  relay_only_for_non_friends TINYINT(1) NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
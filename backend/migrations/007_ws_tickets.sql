@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS ws_tickets (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  ticket_hash CHAR(64) NOT NULL UNIQUE,
+  user_id VARCHAR(36) NOT NULL,
+  client_ip VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_ws_tickets_expires (expires_at)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+  scope VARCHAR(8) NOT NULL,
+  subject VARCHAR(128) NOT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  locked_until TIMESTAMP(3) NULL,
+  PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE IF NOT EXISTS login_audit (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  username VARCHAR(64) NOT NULL,
+  user_id VARCHAR(36) NULL,
+  client_ip VARCHAR(64) NOT NULL,
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  outcome VARCHAR(32) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_login_audit_username (username, created_at),
+  INDEX idx_login_audit_ip (client_ip, created_at)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id VARCHAR(36) PRIMARY KEY,
+  totp_secret VARCHAR(64) NOT NULL,
+  enabled TINYINT(1) NOT NULL DEFAULT 0,
+  last_counter BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  enabled_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  code_hash CHAR(64) NOT NULL,
+  used_at TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_mfa_recovery (user_id, code_hash)
+);
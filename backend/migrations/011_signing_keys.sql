@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+  kid VARCHAR(64) PRIMARY KEY,
+  alg VARCHAR(16) NOT NULL,
+  private_key BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  retired_at TIMESTAMP NULL,
+  expires_at TIMESTAMP NULL
+);
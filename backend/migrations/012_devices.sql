@@ -0,0 +1,9 @@
+ALTER TABLE sessions
+  ADD COLUMN device_name VARCHAR(128) NOT NULL DEFAULT '',
+  ADD COLUMN platform VARCHAR(32) NOT NULL DEFAULT '',
+  ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  ADD COLUMN last_ip VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN last_active_at TIMESTAMP NULL;
+
+ALTER TABLE ws_tickets
+  ADD COLUMN session_id VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  provider VARCHAR(64) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_login_at TIMESTAMP NULL,
+  UNIQUE KEY uniq_identity (provider, subject),
+  UNIQUE KEY uniq_user_provider (user_id, provider)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+  state_hash CHAR(64) PRIMARY KEY,
+  provider VARCHAR(64) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  code_verifier VARCHAR(128) NOT NULL,
+  link_user_id VARCHAR(36) NULL,
+  expires_at TIMESTAMP NOT NULL,
+  INDEX idx_oidc_states_expires (expires_at)
+);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS service_accounts (
+  user_id VARCHAR(36) PRIMARY KEY,
+  owner_user_id VARCHAR(36) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  disabled_at TIMESTAMP NULL,
+  INDEX idx_service_accounts_owner (owner_user_id)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  key_id CHAR(16) PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  key_hash CHAR(64) NOT NULL,
+  scopes VARCHAR(255) NOT NULL,
+  rate_limit VARCHAR(32) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NULL,
+  last_used_at TIMESTAMP NULL,
+  last_used_ip VARCHAR(64) NOT NULL DEFAULT '',
+  revoked_at TIMESTAMP NULL,
+  INDEX idx_api_keys_user (user_id)
+);
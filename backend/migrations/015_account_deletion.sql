@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+  user_id VARCHAR(36) PRIMARY KEY,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  step VARCHAR(32) NOT NULL DEFAULT '',
+  requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  scheduled_for TIMESTAMP NOT NULL,
+  claimed_by VARCHAR(128) NOT NULL DEFAULT '',
+  lease_until TIMESTAMP NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error VARCHAR(512) NOT NULL DEFAULT '',
+  completed_at TIMESTAMP NULL,
+  INDEX idx_account_deletions_due (status, scheduled_for)
+);
@@ -0,0 +1 @@
+ALTER TABLE user_mfa MODIFY totp_secret VARCHAR(255) NOT NULL;
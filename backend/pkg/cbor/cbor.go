@@ -0,0 +1,448 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const maxDepth = 64
+
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+var (
+	ErrUnsupportedType = errors.New("cbor: unsupported type")
+	ErrMalformed       = errors.New("cbor: malformed input")
+	ErrTooDeep         = errors.New("cbor: nesting too deep")
+	ErrInvalidUTF8     = errors.New("cbor: text string is not valid utf-8")
+)
+
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return Marshal(v)
+}
+
+func ToJSON(data []byte) ([]byte, error) {
+	v, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}, depth int) error {
+	if depth > maxDepth {
+		return ErrTooDeep
+	}
+	switch val := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if val {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		writeHead(buf, majorText, uint64(len(val)))
+		buf.WriteString(val)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(val)))
+		buf.Write(val)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+			encodeInt(buf, i)
+			return nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return err
+		}
+		encodeFloat(buf, f)
+	case int:
+		encodeInt(buf, int64(val))
+	case int64:
+		encodeInt(buf, val)
+	case float64:
+		encodeFloat(buf, val)
+	case []interface{}:
+		writeHead(buf, majorArray, uint64(len(val)))
+		for _, item := range val {
+			if err := encode(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeHead(buf, majorMap, uint64(len(val)))
+		for _, k := range keys {
+			writeHead(buf, majorText, uint64(len(k)))
+			buf.WriteString(k)
+			if err := encode(buf, val[k], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 {
+		writeHead(buf, majorUint, uint64(i))
+		return
+	}
+	writeHead(buf, majorNegInt, uint64(-1-i))
+}
+
+func encodeFloat(buf *bytes.Buffer, f float64) {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		encodeInt(buf, int64(f))
+		return
+	}
+	buf.WriteByte(0xfb)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(f))
+	buf.Write(b[:])
+}
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		buf.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(m | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		buf.Write(b[:])
+	case n <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		buf.Write(b[:])
+	default:
+		buf.WriteByte(m | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		buf.Write(b[:])
+	}
+}
+
+func Unmarshal(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrMalformed
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+var errBreak = errors.New("cbor: break")
+
+func (d *decoder) item(depth int) (interface{}, error) {
+	v, err := d.value(depth)
+	if err == errBreak {
+		return nil, ErrMalformed
+	}
+	return v, err
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+	if d.pos >= len(d.data) {
+		return nil, ErrMalformed
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major := initial >> 5
+	info := initial & 0x1f
+
+	if major == majorSimple {
+		return d.simple(info)
+	}
+	if info == 31 {
+		return d.indefinite(major, depth)
+	}
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return float64(n), nil
+		}
+		return int64(n), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return -1 - float64(n), nil
+		}
+		return -1 - int64(n), nil
+	case majorBytes:
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(b))
+		copy(out, b)
+		return out, nil
+	case majorText:
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, ErrInvalidUTF8
+		}
+		return string(b), nil
+	case majorArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrMalformed
+		}
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	case majorMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrMalformed
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			if err := d.entry(m, depth); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		return d.item(depth + 1)
+	}
+	return nil, ErrMalformed
+}
+
+func (d *decoder) indefinite(major byte, depth int) (interface{}, error) {
+	switch major {
+	case majorBytes, majorText:
+		var out []byte
+		for {
+			if d.pos >= len(d.data) {
+				return nil, ErrMalformed
+			}
+			head := d.data[d.pos]
+			d.pos++
+			if head == 0xff {
+				break
+			}
+			if head>>5 != major || head&0x1f == 31 {
+				return nil, ErrMalformed
+			}
+			n, err := d.argument(head & 0x1f)
+			if err != nil {
+				return nil, err
+			}
+			chunk, err := d.take(n)
+			if err != nil {
+				return nil, err
+			}
+			if major == majorText && !utf8.Valid(chunk) {
+				return nil, ErrInvalidUTF8
+			}
+			out = append(out, chunk...)
+		}
+		if major == majorText {
+			return string(out), nil
+		}
+		if out == nil {
+			out = []byte{}
+		}
+		return out, nil
+	case majorArray:
+		arr := make([]interface{}, 0)
+		for {
+			item, err := d.value(depth + 1)
+			if err == errBreak {
+				return arr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+	case majorMap:
+		m := make(map[string]interface{})
+		for {
+			if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+				d.pos++
+				return m, nil
+			}
+			if err := d.entry(m, depth); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, ErrMalformed
+}
+
+func (d *decoder) entry(m map[string]interface{}, depth int) error {
+	key, err := d.item(depth + 1)
+	if err != nil {
+		return err
+	}
+	k, ok := key.(string)
+	if !ok {
+		return ErrUnsupportedType
+	}
+	val, err := d.item(depth + 1)
+	if err != nil {
+		return err
+	}
+	m[k] = val
+	return nil
+}
+
+func (d *decoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		b, err := d.take(2)
+		if err != nil {
+			return nil, err
+		}
+		return halfToFloat(binary.BigEndian.Uint16(b)), nil
+	case 26:
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 27:
+		b, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 31:
+		return nil, errBreak
+	}
+	return nil, ErrUnsupportedType
+}
+
+func (d *decoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.take(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.take(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.take(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.take(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	}
+	return 0, ErrMalformed
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrMalformed
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int((h >> 10) & 0x1f)
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
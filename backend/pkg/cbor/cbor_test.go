@@ -0,0 +1,267 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Vectors from RFC 8949, Appendix A.
+var decodeVectors = []struct {
+	hex  string
+	want interface{}
+}{
+	{"00", int64(0)},
+	{"01", int64(1)},
+	{"0a", int64(10)},
+	{"17", int64(23)},
+	{"1818", int64(24)},
+	{"1819", int64(25)},
+	{"1864", int64(100)},
+	{"1903e8", int64(1000)},
+	{"1a000f4240", int64(1000000)},
+	{"1b000000e8d4a51000", int64(1000000000000)},
+	{"1bffffffffffffffff", float64(18446744073709551615)},
+	{"3bffffffffffffffff", float64(-18446744073709551616)},
+	{"20", int64(-1)},
+	{"29", int64(-10)},
+	{"3863", int64(-100)},
+	{"3903e7", int64(-1000)},
+	{"f90000", 0.0},
+	{"f93c00", 1.0},
+	{"fb3ff199999999999a", 1.1},
+	{"f93e00", 1.5},
+	{"f97bff", 65504.0},
+	{"fa47c35000", 100000.0},
+	{"fa7f7fffff", 3.4028234663852886e+38},
+	{"fb7e37e43c8800759c", 1.0e+300},
+	{"f90001", 5.960464477539063e-8},
+	{"f90400", 0.00006103515625},
+	{"f9c400", -4.0},
+	{"fbc010666666666666", -4.1},
+	{"f97c00", math.Inf(1)},
+	{"f9fc00", math.Inf(-1)},
+	{"fa7f800000", math.Inf(1)},
+	{"faff800000", math.Inf(-1)},
+	{"fb7ff0000000000000", math.Inf(1)},
+	{"fbfff0000000000000", math.Inf(-1)},
+	{"f4", false},
+	{"f5", true},
+	{"f6", nil},
+	{"f7", nil},
+	{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+	{"c11a514b67b0", int64(1363896240)},
+	{"c1fb41d452d9ec200000", 1363896240.5},
+	{"d74401020304", []byte{1, 2, 3, 4}},
+	{"d818456449455446", []byte("dIETF")},
+	{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+	{"40", []byte{}},
+	{"4401020304", []byte{1, 2, 3, 4}},
+	{"60", ""},
+	{"6161", "a"},
+	{"6449455446", "IETF"},
+	{"62225c", "\"\\"},
+	{"62c3bc", "ü"},
+	{"63e6b0b4", "水"},
+	{"64f0908591", "\U00010151"},
+	{"80", []interface{}{}},
+	{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+	{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"98190102030405060708090a0b0c0d0e0f101112131415161718181819", countTo(25)},
+	{"a0", map[string]interface{}{}},
+	{"a26161016162820203", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	{"826161a161626163", []interface{}{"a", map[string]interface{}{"b": "c"}}},
+	{"a56161614161626142616361436164614461656145", map[string]interface{}{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}},
+	{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+	{"7f657374726561646d696e67ff", "streaming"},
+	{"9fff", []interface{}{}},
+	{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"9f01820203820405ff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"83018202039f0405ff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"83019f0203ff820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"9f0102030405060708090a0b0c0d0e0f101112131415161718181819ff", countTo(25)},
+	{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	{"826161bf61626163ff", []interface{}{"a", map[string]interface{}{"b": "c"}}},
+	{"bf6346756ef563416d7421ff", map[string]interface{}{"Fun": true, "Amt": int64(-2)}},
+}
+
+func countTo(n int) []interface{} {
+	out := make([]interface{}, n)
+	for i := range out {
+		out[i] = int64(i + 1)
+	}
+	return out
+}
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestUnmarshalRFCVectors(t *testing.T) {
+	for _, tc := range decodeVectors {
+		got, err := Unmarshal(mustHex(t, tc.hex))
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %v", tc.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", tc.hex, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshalNegativeZeroAndNaN(t *testing.T) {
+	got, err := Unmarshal(mustHex(t, "f98000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := got.(float64); !ok || f != 0 || !math.Signbit(f) {
+		t.Errorf("f98000 = %#v, want -0.0", got)
+	}
+	for _, h := range []string{"f97e00", "fa7fc00000", "fb7ff8000000000000"} {
+		got, err := Unmarshal(mustHex(t, h))
+		if err != nil {
+			t.Fatalf("Unmarshal(%s): %v", h, err)
+		}
+		if f, ok := got.(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("Unmarshal(%s) = %#v, want NaN", h, got)
+		}
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	cases := []struct {
+		hex string
+		err error
+	}{
+		{"", ErrMalformed},
+		{"18", ErrMalformed},
+		{"1c", ErrMalformed},
+		{"62c3", ErrMalformed},
+		{"8301", ErrMalformed},
+		{"ff", ErrMalformed},
+		{"0000", ErrMalformed},
+		{"9f01", ErrMalformed},
+		{"5f01ff", ErrMalformed},
+		{"5f6161ff", ErrMalformed},
+		{"5f5f4101ffff", ErrMalformed},
+		{"7f7f6161ffff", ErrMalformed},
+		{"5f41", ErrMalformed},
+		{"62c328", ErrInvalidUTF8},
+		{"7f616161c3ff", ErrInvalidUTF8},
+		{"a162c3286161", ErrInvalidUTF8},
+		{"a201020304", ErrUnsupportedType},
+		{"f0", ErrUnsupportedType},
+		{"9bffffffffffffffff", ErrMalformed},
+	}
+	for _, tc := range cases {
+		if _, err := Unmarshal(mustHex(t, tc.hex)); err != tc.err {
+			t.Errorf("Unmarshal(%s) error = %v, want %v", tc.hex, err, tc.err)
+		}
+	}
+
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+2)
+	deep = append(deep, 0x00)
+	if _, err := Unmarshal(deep); err != ErrTooDeep {
+		t.Errorf("deep nesting error = %v, want %v", err, ErrTooDeep)
+	}
+}
+
+func TestMarshalRFCVectors(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		hex   string
+	}{
+		{int64(0), "00"},
+		{int64(23), "17"},
+		{int64(24), "1818"},
+		{int64(1000), "1903e8"},
+		{int64(1000000), "1a000f4240"},
+		{int64(1000000000000), "1b000000e8d4a51000"},
+		{int64(-1), "20"},
+		{int64(-1000), "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{-4.1, "fbc010666666666666"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"", "60"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]interface{}{}, "80"},
+		{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, "8301820203820405"},
+		{countTo(25), "98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+		{map[string]interface{}{}, "a0"},
+		{map[string]interface{}{"b": []interface{}{int64(2), int64(3)}, "a": int64(1)}, "a26161016162820203"},
+		{map[string]interface{}{"e": "E", "d": "D", "c": "C", "b": "B", "a": "A"}, "a56161614161626142616361436164614461656145"},
+		{json.Number("100"), "1864"},
+		{json.Number("-4.1"), "fbc010666666666666"},
+	}
+	for _, tc := range cases {
+		got, err := Marshal(tc.value)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tc.value, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tc.hex {
+			t.Errorf("Marshal(%#v) = %x, want %s", tc.value, got, tc.hex)
+		}
+	}
+	if _, err := Marshal(struct{}{}); err != ErrUnsupportedType {
+		t.Errorf("Marshal(struct) error = %v, want %v", err, ErrUnsupportedType)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	doc := `{"a":[1,-2,3.5,"x",true,null],"b":{"c":"d"}}`
+	data, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != doc {
+		t.Errorf("round trip = %s, want %s", back, doc)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, tc := range decodeVectors {
+		f.Add(mustHex(f, tc.hex))
+	}
+	f.Add([]byte{0x9f, 0x9f, 0x9f})
+	f.Add([]byte{0xbf, 0x61, 0x61})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		encoded, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal of decoded value failed: %v", err)
+		}
+		again, err := Unmarshal(encoded)
+		if err != nil {
+			t.Fatalf("Unmarshal of re-encoded value failed: %v", err)
+		}
+		reencoded, err := Marshal(again)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("encoding not stable: %x != %x", encoded, reencoded)
+		}
+	})
+}
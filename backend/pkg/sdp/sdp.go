@@ -0,0 +1,194 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrEmpty       = errors.New("sdp is empty")
+	ErrTooLarge    = errors.New("sdp exceeds size limit")
+	ErrNoVersion   = errors.New("sdp must start with v=0")
+	ErrMissingLine = errors.New("sdp is missing a required line")
+	ErrInvalidUTF8 = errors.New("sdp is not valid utf-8")
+)
+
+type Candidate struct {
+	Foundation string
+	Component  int
+	Transport  string
+	Priority   uint32
+	Address    string
+	Port       int
+	Type       string
+	Extensions []string
+}
+
+var candidateTypes = map[string]struct{}{
+	"host":  {},
+	"srflx": {},
+	"prflx": {},
+	"relay": {},
+}
+
+func Validate(body string, maxSize int) error {
+	if strings.TrimSpace(body) == "" {
+		return ErrEmpty
+	}
+	if len(body) > maxSize {
+		return ErrTooLarge
+	}
+	if !utf8.ValidString(body) {
+		return ErrInvalidUTF8
+	}
+	lines := splitLines(body)
+	if lines[0] != "v=0" {
+		return ErrNoVersion
+	}
+	seen := make(map[byte]bool)
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' || line[0] < 'a' || line[0] > 'z' {
+			return fmt.Errorf("malformed sdp line %d", i+1)
+		}
+		seen[line[0]] = true
+		if strings.HasPrefix(line, "a=candidate:") {
+			if _, err := ParseCandidate(strings.TrimPrefix(line, "a=")); err != nil {
+				return fmt.Errorf("sdp line %d: %w", i+1, err)
+			}
+		}
+	}
+	for _, required := range []byte{'o', 's', 't', 'm'} {
+		if !seen[required] {
+			return fmt.Errorf("%w: %c=", ErrMissingLine, required)
+		}
+	}
+	return nil
+}
+
+func ParseCandidate(value string) (Candidate, error) {
+	var c Candidate
+	if !utf8.ValidString(value) {
+		return c, errors.New("candidate is not valid utf-8")
+	}
+	value = strings.TrimPrefix(value, "a=")
+	if !strings.HasPrefix(value, "candidate:") {
+		return c, errors.New("candidate must start with candidate:")
+	}
+	fields := strings.Fields(strings.TrimPrefix(value, "candidate:"))
+	if len(fields) < 8 {
+		return c, errors.New("candidate has too few fields")
+	}
+	c.Foundation = fields[0]
+	if len(c.Foundation) == 0 || len(c.Foundation) > 32 || !isICEChars(c.Foundation) {
+		return c, errors.New("invalid candidate foundation")
+	}
+	component, err := strconv.Atoi(fields[1])
+	if err != nil || component < 1 || component > 256 {
+		return c, errors.New("invalid candidate component")
+	}
+	c.Component = component
+	c.Transport = strings.ToLower(fields[2])
+	if c.Transport != "udp" && c.Transport != "tcp" {
+		return c, errors.New("invalid candidate transport")
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return c, errors.New("invalid candidate priority")
+	}
+	c.Priority = uint32(priority)
+	c.Address = fields[4]
+	if c.Address == "" || len(c.Address) > 255 {
+		return c, errors.New("invalid candidate address")
+	}
+	port, err := strconv.Atoi(fields[5])
+	if err != nil || port < 0 || port > 65535 {
+		return c, errors.New("invalid candidate port")
+	}
+	c.Port = port
+	if fields[6] != "typ" {
+		return c, errors.New("candidate is missing typ")
+	}
+	c.Type = fields[7]
+	if _, ok := candidateTypes[c.Type]; !ok {
+		return c, errors.New("invalid candidate type")
+	}
+	c.Extensions = fields[8:]
+	return c, nil
+}
+
+func splitLines(body string) []string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func isICEChars(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '+', r == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (c Candidate) String() string {
+	parts := []string{
+		"candidate:" + c.Foundation,
+		strconv.Itoa(c.Component),
+		c.Transport,
+		strconv.FormatUint(uint64(c.Priority), 10),
+		c.Address,
+		strconv.Itoa(c.Port),
+		"typ",
+		c.Type,
+	}
+	return strings.Join(append(parts, c.Extensions...), " ")
+}
+
+func (c *Candidate) ClearRelated() {
+	ext := make([]string, len(c.Extensions))
+	copy(ext, c.Extensions)
+	for i := 0; i+1 < len(ext); i += 2 {
+		switch ext[i] {
+		case "raddr":
+			ext[i+1] = "0.0.0.0"
+		case "rport":
+			ext[i+1] = "0"
+		}
+	}
+	c.Extensions = ext
+}
+
+func RewriteCandidates(body string, rewrite func(Candidate) (Candidate, bool)) string {
+	eol := "\n"
+	if strings.Contains(body, "\r\n") {
+		eol = "\r\n"
+	}
+	lines := strings.Split(body, eol)
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "a=candidate:") {
+			c, err := ParseCandidate(line)
+			if err != nil {
+				continue
+			}
+			c, keep := rewrite(c)
+			if !keep {
+				continue
+			}
+			line = "a=" + c.String()
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, eol)
+}
@@ -0,0 +1,284 @@
+package sdp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const chromeOffer = "v=0\r\n" +
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=group:BUNDLE 0\r\n" +
+	"a=extmap-allow-mixed\r\n" +
+	"a=msid-semantic: WMS\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111 63 9 0 8 13 110 126\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtcp:9 IN IP4 0.0.0.0\r\n" +
+	"a=candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0 network-id 1\r\n" +
+	"a=candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243 generation 0 network-id 1\r\n" +
+	"a=candidate:1853887674 1 tcp 1518280447 192.168.0.196 9 typ host tcptype active generation 0 network-id 1\r\n" +
+	"a=candidate:3745204734 1 udp 41885439 198.51.100.20 3478 typ relay raddr 203.0.113.7 rport 46243 generation 0 network-id 1\r\n" +
+	"a=ice-ufrag:EsAw\r\n" +
+	"a=ice-pwd:bP+XJMM09aR8AiX1jdukzR6Y\r\n" +
+	"a=ice-options:trickle\r\n" +
+	"a=fingerprint:sha-256 DA:52:67:C5:2A:2E:91:13:A2:7D:3A:E1:2E:A4:F3:28:90:67:71:0E:B7:6F:7B:56:79:F4:B2:D1:54:4B:92:7E\r\n" +
+	"a=setup:actpass\r\n" +
+	"a=mid:0\r\n" +
+	"a=sendrecv\r\n" +
+	"a=rtcp-mux\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n" +
+	"a=fmtp:111 minptime=10;useinbandfec=1\r\n"
+
+const firefoxAnswer = "v=0\n" +
+	"o=mozilla...THIS_IS_SDPARTA-99.0 7185293727208416432 0 IN IP4 0.0.0.0\n" +
+	"s=-\n" +
+	"t=0 0\n" +
+	"a=fingerprint:sha-256 2B:9E:4F:7D:63:2C:A6:47:93:5A:45:36:91:B1:2E:0F:3E:2A:7B:5C:1D:82:A4:64:F7:33:DB:15:6C:9E:05:41\n" +
+	"a=group:BUNDLE 0\n" +
+	"a=ice-options:trickle\n" +
+	"a=msid-semantic:WMS *\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 109\n" +
+	"c=IN IP4 0.0.0.0\n" +
+	"a=candidate:0 1 UDP 2122252543 10.0.0.5 53412 typ host\n" +
+	"a=candidate:1 1 UDP 1686052863 203.0.113.9 53412 typ srflx raddr 10.0.0.5 rport 53412\n" +
+	"a=sendrecv\n" +
+	"a=ice-pwd:4ad7b5b5f0a6d1c3e2f1a0b9c8d7e6f5\n" +
+	"a=ice-ufrag:8a1b2c3d\n" +
+	"a=mid:0\n" +
+	"a=rtcp-mux\n" +
+	"a=rtpmap:109 opus/48000/2\n" +
+	"a=setup:active\n"
+
+func TestValidateAcceptsBrowserSDP(t *testing.T) {
+	for name, body := range map[string]string{"chrome": chromeOffer, "firefox": firefoxAnswer} {
+		if err := Validate(body, 64*1024); err != nil {
+			t.Errorf("%s: Validate() = %v", name, err)
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		max  int
+		err  error
+	}{
+		{"empty", "", 1024, ErrEmpty},
+		{"whitespace", " \r\n\t", 1024, ErrEmpty},
+		{"oversize", chromeOffer, len(chromeOffer) - 1, ErrTooLarge},
+		{"no version", strings.Replace(chromeOffer, "v=0", "v=1", 1), 64 * 1024, ErrNoVersion},
+		{"leading garbage", "x\r\n" + chromeOffer, 64 * 1024, ErrNoVersion},
+		{"missing origin", strings.Replace(chromeOffer, "o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n", "", 1), 64 * 1024, ErrMissingLine},
+		{"missing session name", strings.Replace(chromeOffer, "s=-\r\n", "", 1), 64 * 1024, ErrMissingLine},
+		{"missing timing", strings.Replace(chromeOffer, "t=0 0\r\n", "", 1), 64 * 1024, ErrMissingLine},
+		{"missing media", "v=0\r\no=- 1 1 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n", 64 * 1024, ErrMissingLine},
+		{"non utf-8", strings.Replace(chromeOffer, "s=-", "s=\xff\xfe", 1), 64 * 1024, ErrInvalidUTF8},
+		{"truncated utf-8", chromeOffer + "a=label:\xe6\xb0", 64 * 1024, ErrInvalidUTF8},
+	}
+	for _, tc := range cases {
+		if err := Validate(tc.body, tc.max); !errors.Is(err, tc.err) {
+			t.Errorf("%s: Validate() = %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	malformed := []struct {
+		name string
+		body string
+	}{
+		{"uppercase key", strings.Replace(chromeOffer, "s=-", "S=-", 1)},
+		{"missing equals", strings.Replace(chromeOffer, "a=rtcp-mux", "artcp-mux", 1)},
+		{"single char line", strings.Replace(chromeOffer, "a=sendrecv", "a", 1)},
+		{"bad candidate port", strings.Replace(chromeOffer, "46243 typ host", "70000 typ host", 1)},
+		{"bad candidate type", strings.Replace(chromeOffer, "typ relay", "typ bogus", 1)},
+	}
+	for _, tc := range malformed {
+		if err := Validate(tc.body, 64*1024); err == nil {
+			t.Errorf("%s: Validate() succeeded, want error", tc.name)
+		}
+	}
+}
+
+func TestParseCandidate(t *testing.T) {
+	cases := []struct {
+		line string
+		want Candidate
+	}{
+		{
+			"candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0 network-id 1",
+			Candidate{Foundation: "1467250027", Component: 1, Transport: "udp", Priority: 2122260223, Address: "192.168.0.196", Port: 46243, Type: "host", Extensions: []string{"generation", "0", "network-id", "1"}},
+		},
+		{
+			"a=candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243",
+			Candidate{Foundation: "842163049", Component: 1, Transport: "udp", Priority: 1686052607, Address: "203.0.113.7", Port: 46243, Type: "srflx", Extensions: []string{"raddr", "192.168.0.196", "rport", "46243"}},
+		},
+		{
+			"candidate:0 1 UDP 2122252543 a3f2c1d0-5b6e-4f7a-8c9d-0e1f2a3b4c5d.local 53412 typ host",
+			Candidate{Foundation: "0", Component: 1, Transport: "udp", Priority: 2122252543, Address: "a3f2c1d0-5b6e-4f7a-8c9d-0e1f2a3b4c5d.local", Port: 53412, Type: "host", Extensions: []string{}},
+		},
+		{
+			"candidate:3 2 tcp 1518280447 2001:db8::1 9 typ host tcptype active",
+			Candidate{Foundation: "3", Component: 2, Transport: "tcp", Priority: 1518280447, Address: "2001:db8::1", Port: 9, Type: "host", Extensions: []string{"tcptype", "active"}},
+		},
+	}
+	for _, tc := range cases {
+		got, err := ParseCandidate(tc.line)
+		if err != nil {
+			t.Errorf("ParseCandidate(%q): %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseCandidate(%q) = %+v, want %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestParseCandidateRejects(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"1 1 udp 1 10.0.0.1 1 typ host",
+		"candidate:1 1 udp 1 10.0.0.1 1 typ",
+		"candidate:f!o 1 udp 1 10.0.0.1 1 typ host",
+		"candidate:" + strings.Repeat("a", 33) + " 1 udp 1 10.0.0.1 1 typ host",
+		"candidate:1 0 udp 1 10.0.0.1 1 typ host",
+		"candidate:1 257 udp 1 10.0.0.1 1 typ host",
+		"candidate:1 x udp 1 10.0.0.1 1 typ host",
+		"candidate:1 1 sctp 1 10.0.0.1 1 typ host",
+		"candidate:1 1 udp 4294967296 10.0.0.1 1 typ host",
+		"candidate:1 1 udp -1 10.0.0.1 1 typ host",
+		"candidate:1 1 udp 1 " + strings.Repeat("a", 256) + " 1 typ host",
+		"candidate:1 1 udp 1 10.0.0.1 -1 typ host",
+		"candidate:1 1 udp 1 10.0.0.1 65536 typ host",
+		"candidate:1 1 udp 1 10.0.0.1 port typ host",
+		"candidate:1 1 udp 1 10.0.0.1 1 type host",
+		"candidate:1 1 udp 1 10.0.0.1 1 typ turn",
+		"candidate:1 1 udp 1 10.0.0.\xff 1 typ host",
+	} {
+		if _, err := ParseCandidate(line); err == nil {
+			t.Errorf("ParseCandidate(%q) succeeded, want error", line)
+		}
+	}
+}
+
+func FuzzValidate(f *testing.F) {
+	f.Add(chromeOffer, 64*1024)
+	f.Add(firefoxAnswer, 64*1024)
+	f.Add("v=0\no=- 1 1 IN IP4 0.0.0.0\ns=-\nt=0 0\nm=audio 9 RTP/AVP 0\n", 128)
+	f.Fuzz(func(t *testing.T, body string, max int) {
+		_ = Validate(body, max)
+	})
+}
+
+func FuzzParseCandidate(f *testing.F) {
+	f.Add("candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0")
+	f.Add("a=candidate:842163049 1 UDP 1686052607 203.0.113.7 46243 typ srflx raddr 10.0.0.1 rport 1")
+	f.Add("candidate:3 2 tcp 1518280447 2001:db8::1 9 typ host tcptype active")
+	f.Fuzz(func(t *testing.T, line string) {
+		c, err := ParseCandidate(line)
+		if err != nil {
+			return
+		}
+		again, err := ParseCandidate(c.String())
+		if err != nil {
+			t.Fatalf("reparse of %q failed: %v", c.String(), err)
+		}
+		if !reflect.DeepEqual(c, again) {
+			t.Fatalf("round trip mismatch: %+v != %+v", c, again)
+		}
+	})
+}
+
+func TestCandidateString(t *testing.T) {
+	for _, line := range []string{
+		"candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0 network-id 1",
+		"candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243",
+		"candidate:3 2 tcp 1518280447 2001:db8::1 9 typ host tcptype active",
+	} {
+		c, err := ParseCandidate(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.String(); got != line {
+			t.Errorf("String() = %q, want %q", got, line)
+		}
+	}
+
+	c, err := ParseCandidate("candidate:0 1 UDP 2122252543 10.0.0.5 53412 typ host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.String(), "candidate:0 1 udp 2122252543 10.0.0.5 53412 typ host"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestClearRelated(t *testing.T) {
+	c, err := ParseCandidate("candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 192.168.0.196 rport 46243 generation 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := c.Extensions
+	c.ClearRelated()
+	want := []string{"raddr", "0.0.0.0", "rport", "0", "generation", "0"}
+	if !reflect.DeepEqual(c.Extensions, want) {
+		t.Errorf("Extensions = %v, want %v", c.Extensions, want)
+	}
+	if original[1] != "192.168.0.196" || original[3] != "46243" {
+		t.Errorf("ClearRelated mutated the original extensions: %v", original)
+	}
+
+	host, err := ParseCandidate("candidate:1 1 udp 1 10.0.0.1 1 typ host generation 0 raddr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.ClearRelated()
+	if want := []string{"generation", "0", "raddr"}; !reflect.DeepEqual(host.Extensions, want) {
+		t.Errorf("Extensions = %v, want %v", host.Extensions, want)
+	}
+}
+
+func TestRewriteCandidates(t *testing.T) {
+	var seen []string
+	out := RewriteCandidates(chromeOffer, func(c Candidate) (Candidate, bool) {
+		seen = append(seen, c.Type)
+		if c.Type == "host" {
+			return c, false
+		}
+		c.ClearRelated()
+		return c, true
+	})
+	if want := []string{"host", "srflx", "host", "relay"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("visited %v, want %v", seen, want)
+	}
+	if strings.Contains(out, "typ host") {
+		t.Errorf("host candidates were not removed:\n%s", out)
+	}
+	for _, want := range []string{
+		"a=candidate:842163049 1 udp 1686052607 203.0.113.7 46243 typ srflx raddr 0.0.0.0 rport 0 generation 0 network-id 1\r\n",
+		"a=candidate:3745204734 1 udp 41885439 198.51.100.20 3478 typ relay raddr 0.0.0.0 rport 0 generation 0 network-id 1\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Errorf("line endings were not preserved:\n%q", out)
+	}
+	if err := Validate(out, 64*1024); err != nil {
+		t.Errorf("rewritten sdp is invalid: %v", err)
+	}
+
+	unchanged := RewriteCandidates(firefoxAnswer, func(c Candidate) (Candidate, bool) { return c, true })
+	want := strings.ReplaceAll(firefoxAnswer, " UDP ", " udp ")
+	if unchanged != want {
+		t.Errorf("identity rewrite changed sdp:\n%s", unchanged)
+	}
+
+	broken := "v=0\na=candidate:bogus\na=candidate:1 1 udp 1 10.0.0.1 1 typ host\n"
+	if got, want := RewriteCandidates(broken, func(c Candidate) (Candidate, bool) { return c, true }), "v=0\na=candidate:1 1 udp 1 10.0.0.1 1 typ host\n"; got != want {
+		t.Errorf("RewriteCandidates dropped the wrong lines: %q, want %q", got, want)
+	}
+}
@@ -1,15 +1,164 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var errInvalidHash = errors.New("invalid password hash")
+
+var dummyHash, _ = HashPassword("dummy-password-for-timing")
+
+var (
+	legacyMu    sync.RWMutex
+	legacyShare float64
+	legacyHash  []byte
+	dummyKey    = randomKey()
+)
 
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	p := DefaultArgon2Params
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", err
 	}
-	return string(hash), nil
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
 func CheckPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
+
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return true
+	}
+	p, _, _, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+	want := DefaultArgon2Params
+	return p.Memory != want.Memory || p.Iterations != want.Iterations ||
+		p.Parallelism != want.Parallelism || p.KeyLength != want.KeyLength
+}
+
+func CheckDummyPassword(username, password string) {
+	if hash := legacyDummy(username); hash != nil {
+		_ = bcrypt.CompareHashAndPassword(hash, []byte(password))
+		return
+	}
+	_ = CheckPassword(password, dummyHash)
+}
+
+func legacyDummy(username string) []byte {
+	legacyMu.RLock()
+	defer legacyMu.RUnlock()
+	if legacyHash != nil && usernameFraction(username) < legacyShare {
+		return legacyHash
+	}
+	return nil
+}
+
+func SetLegacyHashProfile(share float64, sample string) error {
+	if share <= 0 {
+		legacyMu.Lock()
+		legacyShare, legacyHash = 0, nil
+		legacyMu.Unlock()
+		return nil
+	}
+	cost, err := bcrypt.Cost([]byte(sample))
+	if err != nil {
+		return err
+	}
+	legacyMu.RLock()
+	hash := legacyHash
+	legacyMu.RUnlock()
+	if c, err := bcrypt.Cost(hash); err != nil || c != cost {
+		hash, err = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), cost)
+		if err != nil {
+			return err
+		}
+	}
+	legacyMu.Lock()
+	legacyShare, legacyHash = share, hash
+	legacyMu.Unlock()
+	return nil
+}
+
+func usernameFraction(username string) float64 {
+	mac := hmac.New(sha256.New, dummyKey)
+	mac.Write([]byte(username))
+	return float64(binary.BigEndian.Uint64(mac.Sum(nil))>>11) / (1 << 53)
+}
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
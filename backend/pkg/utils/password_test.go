@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPasswordFormats(t *testing.T) {
+	argon, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{argon, string(legacy)} {
+		if !CheckPassword("hunter2", hash) || CheckPassword("hunter3", hash) {
+			t.Errorf("CheckPassword mismatch for %.10s", hash)
+		}
+	}
+	if NeedsRehash(argon) || !NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash picked the wrong hash")
+	}
+}
+
+func TestLegacyDummyFollowsStoredHashes(t *testing.T) {
+	t.Cleanup(func() { SetLegacyHashProfile(0, "") })
+	sample, err := bcrypt.GenerateFromPassword([]byte("x"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetLegacyHashProfile(0.25, string(sample)); err != nil {
+		t.Fatal(err)
+	}
+	hash := legacyDummy("")
+	for i := 0; hash == nil && i < 100; i++ {
+		hash = legacyDummy(fmt.Sprint("user", i))
+	}
+	if cost, err := bcrypt.Cost(hash); err != nil || cost != bcrypt.MinCost {
+		t.Fatalf("dummy bcrypt cost = %d, %v; want %d", cost, err, bcrypt.MinCost)
+	}
+
+	legacy := 0
+	const n = 4000
+	for i := 0; i < n; i++ {
+		name := fmt.Sprint("user", i)
+		first := legacyDummy(name) != nil
+		if first != (legacyDummy(name) != nil) {
+			t.Fatalf("%s switched algorithms between checks", name)
+		}
+		if first {
+			legacy++
+		}
+	}
+	if share := float64(legacy) / n; share < 0.2 || share > 0.3 {
+		t.Errorf("bcrypt share = %.3f, want about 0.25", share)
+	}
+
+	if err := SetLegacyHashProfile(0, ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if legacyDummy(fmt.Sprint("user", i)) != nil {
+			t.Fatal("bcrypt dummy used after every hash was migrated")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B seed "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8-digit SHA-1 codes; a 6-digit code is their low six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := TOTPCode(rfcSecret, v.unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.code[2:]; got != want {
+			t.Errorf("TOTPCode(T=%d) = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestTOTPCodeAcceptsLowercaseSecret(t *testing.T) {
+	got, err := TOTPCode(" "+strings.ToLower(rfcSecret)+" ", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "287082" {
+		t.Errorf("TOTPCode = %s, want 287082", got)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestVerifyTOTPRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		counter, ok := VerifyTOTP(rfcSecret, v.code[2:], now, 0)
+		if !ok || counter != v.unix/totpPeriod {
+			t.Errorf("VerifyTOTP(T=%d) = %d, %v; want %d, true", v.unix, counter, ok, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestVerifyTOTPWindowAndReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	code := func(counter int64) string {
+		c, err := TOTPCode(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	for _, offset := range []int64{-1, 0, 1} {
+		if counter, ok := VerifyTOTP(rfcSecret, code(current+offset), now, 0); !ok || counter != current+offset {
+			t.Errorf("offset %d rejected", offset)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := VerifyTOTP(rfcSecret, code(current+offset), now, 0); ok {
+			t.Errorf("offset %d accepted outside the skew window", offset)
+		}
+	}
+	if _, ok := VerifyTOTP(rfcSecret, code(current), now, current); ok {
+		t.Error("replayed code accepted")
+	}
+	if _, ok := VerifyTOTP(rfcSecret, code(current-1), now, current); ok {
+		t.Error("code older than the last accepted counter accepted")
+	}
+	if counter, ok := VerifyTOTP(rfcSecret, code(current+1), now, current); !ok || counter != current+1 {
+		t.Error("next code rejected after the current one was used")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(rfcSecret, bad, now, 0); ok {
+			t.Errorf("VerifyTOTP(%q) accepted", bad)
+		}
+	}
+	if _, ok := VerifyTOTP(rfcSecret, " "+code(current)+" ", now, 0); !ok {
+		t.Error("code with surrounding whitespace rejected")
+	}
+}
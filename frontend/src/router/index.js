@@ -5,6 +5,7 @@ import RegisterPage from "../pages/RegisterPage.vue";
 import FriendsPage from "../pages/FriendsPage.vue";
 import GroupsPage from "../pages/GroupsPage.vue";
 import ChatPage from "../pages/ChatPage.vue";
+import OidcCallbackPage from "../pages/OidcCallbackPage.vue";
 
 const router = createRouter({
   history: createWebHistory(),
@@ -12,6 +13,7 @@ const router = createRouter({
     { path: "/", redirect: "/friends" },
     { path: "/login", component: LoginPage },
     { path: "/register", component: RegisterPage },
+    { path: "/oidc/:provider/callback", component: OidcCallbackPage },
     { path: "/friends", component: FriendsPage, meta: { requiresAuth: true } },
     { path: "/groups", component: GroupsPage, meta: { requiresAuth: true } },
     { path: "/chat", component: ChatPage, meta: { requiresAuth: true } }
@@ -1,39 +1,87 @@
+import api from "./api";
+
+const PROTOCOL_VERSION = 2;
+const FEATURES = ["activity", "group.broadcast", "presence.rich", "presence.subscribe", "ice.policy"];
+
 class SignalingClient {
   constructor() {
     this.socket = null;
     this.connected = false;
     this.listeners = new Set();
     this.reconnectTimer = null;
+    this.connecting = false;
     this.token = "";
+    this.session = null;
+    this.lastHeartbeat = 0;
+    this.activityHandler = () => this.heartbeat();
   }
 
-  connect(token) {
-    if (this.socket && this.connected) return;
+  async connect(token) {
     this.token = token;
-    const url = `ws://localhost:8080/ws?token=${token}`;
-    this.socket = new WebSocket(url);
+    if (this.connecting || this.isOpen()) return;
+    this.connecting = true;
+    let ticket;
+    try {
+      const res = await api.post("/ws/ticket");
+      ticket = res.data.ticket;
+    } catch {
+      this.connecting = false;
+      this.scheduleReconnect();
+      return;
+    }
+    this.connecting = false;
+    if (this.token !== token) {
+      if (this.token) this.connect(this.token);
+      return;
+    }
+    if (this.isOpen()) return;
+    const url = `ws://localhost:8080/ws?ticket=${encodeURIComponent(ticket)}`;
+    const socket = new WebSocket(url);
+    this.socket = socket;
 
-    this.socket.onopen = () => {
-      this.connected = true;
-      this.emit({ type: "ws.connected" });
+    socket.onopen = () => {
+      if (this.socket !== socket) return;
+      socket.send(JSON.stringify({ type: "hello", payload: { version: PROTOCOL_VERSION, features: FEATURES } }));
     };
 
-    this.socket.onmessage = (event) => {
+    socket.onmessage = (event) => {
+      if (this.socket !== socket) return;
+      let data;
       try {
-        const data = JSON.parse(event.data);
-        this.emit(data);
+        data = JSON.parse(event.data);
       } catch {
         this.emit({ type: "ws.invalid", raw: event.data });
+        return;
       }
+      if (data.type === "welcome") {
+        this.session = data.payload;
+        this.connected = true;
+        this.lastHeartbeat = Date.now();
+        this.trackActivity();
+        this.emit({ type: "ws.connected", session: this.session });
+        return;
+      }
+      if (data.type === "ice.policy" && this.session) {
+        this.session = { ...this.session, icePolicy: data.payload };
+      }
+      this.emit(data);
     };
 
-    this.socket.onclose = () => {
+    socket.onclose = (event) => {
+      if (this.socket !== socket) return;
+      this.socket = null;
       this.connected = false;
-      this.emit({ type: "ws.disconnected" });
+      this.session = null;
+      this.emit({ type: "ws.disconnected", code: event.code, reason: event.reason });
+      if (event.code === 4001 || event.code === 4003 || event.code === 4009) return;
       this.scheduleReconnect();
     };
   }
 
+  isOpen() {
+    return !!this.socket && (this.socket.readyState === WebSocket.CONNECTING || this.socket.readyState === WebSocket.OPEN);
+  }
+
   scheduleReconnect() {
     if (this.reconnectTimer || !this.token) return;
     this.reconnectTimer = window.setTimeout(() => {
@@ -43,10 +91,33 @@ class SignalingClient {
   }
 
   send(message) {
-    if (!this.socket || this.socket.readyState !== WebSocket.OPEN) return;
+    if (!this.socket || !this.connected) return;
     this.socket.send(JSON.stringify(message));
   }
 
+  trackActivity() {
+    ["keydown", "pointerdown", "mousemove", "focus"].forEach((name) =>
+      window.addEventListener(name, this.activityHandler, { passive: true })
+    );
+  }
+
+  untrackActivity() {
+    ["keydown", "pointerdown", "mousemove", "focus"].forEach((name) =>
+      window.removeEventListener(name, this.activityHandler)
+    );
+  }
+
+  heartbeat() {
+    const now = Date.now();
+    if (now - this.lastHeartbeat < 60000) return;
+    this.lastHeartbeat = now;
+    this.send({ type: "presence.heartbeat" });
+  }
+
+  setPresence(status, message = "") {
+    this.send({ type: "presence.set", payload: { status, message } });
+  }
+
   onMessage(handler) {
     this.listeners.add(handler);
     return () => this.listeners.delete(handler);
@@ -62,11 +133,18 @@ class SignalingClient {
       clearTimeout(this.reconnectTimer);
       this.reconnectTimer = null;
     }
-    if (this.socket) {
-      this.socket.close();
-    }
+    this.untrackActivity();
+    const socket = this.socket;
+    const wasConnected = this.connected;
     this.socket = null;
+    this.session = null;
     this.connected = false;
+    if (socket) {
+      socket.close();
+    }
+    if (wasConnected) {
+      this.emit({ type: "ws.disconnected", code: 1000, reason: "" });
+    }
   }
 }
 
@@ -24,7 +24,31 @@ export const useAuthStore = defineStore("auth", {
     },
     async login(payload) {
       const res = await api.post("/auth/login", payload);
+      if (res.data.mfaRequired) {
+        return { mfaRequired: true, challengeToken: res.data.challengeToken };
+      }
+      this.setSession(res.data);
+      return { mfaRequired: false };
+    },
+    async verifyMfa(challengeToken, code) {
+      const res = await api.post("/auth/mfa/verify", { challengeToken, code });
+      this.setSession(res.data);
+    },
+    async oidcProviders() {
+      const res = await api.get("/auth/oidc/providers");
+      return res.data;
+    },
+    async startOidc(provider) {
+      const res = await api.post(`/auth/oidc/${encodeURIComponent(provider)}/start`);
+      window.location.assign(res.data.url);
+    },
+    async completeOidc(provider, code, state) {
+      const res = await api.post(`/auth/oidc/${encodeURIComponent(provider)}/callback`, { code, state });
+      if (res.data.mfaRequired) {
+        return { mfaRequired: true, challengeToken: res.data.challengeToken };
+      }
       this.setSession(res.data);
+      return { mfaRequired: false };
     },
     async register(payload) {
       const res = await api.post("/auth/register", payload);